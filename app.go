@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -16,25 +18,72 @@ type App struct {
 	fileServer *FileServer
 	history    []UploadRecord
 	historyMu  sync.Mutex
+	store      *historyStore
+	configMu   sync.RWMutex // guards config; read it with settings, change it with updateConfig
+	approvals  *deviceApprovals
+
+	textHistory []TextMessage
+	textMu      sync.Mutex
+
+	headless bool // running without the Wails GUI (see main_headless.go)
+
+	// Command line overrides of the headless build. They replace the config
+	// values in settings but are never saved.
+	saveDirOverride string
+	httpsOverride   bool
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
 	cfg := LoadConfig()
+	store := newHistoryStore()
 	app := &App{
-		config:  cfg,
-		history: make([]UploadRecord, 0),
+		config:    cfg,
+		history:   store.Recent(10),
+		store:     store,
+		approvals: newDeviceApprovals(),
 	}
 	app.fileServer = NewFileServer(app)
 	return app
 }
 
+// settings returns a snapshot of the config with the command line overrides
+// applied. Handlers read settings through it; slices in the config are
+// replaced, never changed in place.
+func (a *App) settings() Config {
+	a.configMu.RLock()
+	cfg := *a.config
+	a.configMu.RUnlock()
+
+	if a.saveDirOverride != "" {
+		cfg.SaveDir = a.saveDirOverride
+	}
+	if a.httpsOverride {
+		cfg.UseHTTPS = true
+	}
+	return cfg
+}
+
+// updateConfig changes the config with fn and saves it. Changes and saves are
+// serialized, and nothing is changed when fn returns an error.
+func (a *App) updateConfig(fn func(cfg *Config) error) error {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	cfg := *a.config
+	if err := fn(&cfg); err != nil {
+		return err
+	}
+	*a.config = cfg
+	return SaveConfig(a.config)
+}
+
 // startup is called when the app starts
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 
 	// Ensure save directory exists
-	os.MkdirAll(a.config.SaveDir, 0755)
+	os.MkdirAll(a.GetSaveDir(), 0755)
 
 	// Start the HTTP server
 	if err := a.fileServer.Start(); err != nil {
@@ -46,29 +95,79 @@ func (a *App) startup(ctx context.Context) {
 func (a *App) shutdown(ctx context.Context) {
 	if a.fileServer != nil {
 		a.fileServer.Stop()
+		// Let queued images finish so no upload is lost
+		a.fileServer.compress.Close()
 	}
 }
 
 // GetServerInfo returns server information for the frontend
 func (a *App) GetServerInfo() map[string]interface{} {
+	cfg := a.settings()
 	return map[string]interface{}{
-		"running":   a.fileServer.IsRunning(),
-		"url":       a.fileServer.GetUploadURL(),
-		"port":      a.fileServer.GetPort(),
-		"lanIP":     a.fileServer.GetLANIP(),
-		"saveDir":   a.config.SaveDir,
-		"lang":      a.config.Lang,
+		"running":         a.fileServer.IsRunning(),
+		"url":             a.fileServer.GetUploadURL(),
+		"port":            a.fileServer.GetPort(),
+		"lanIP":           a.fileServer.GetLANIP(),
+		"saveDir":         cfg.SaveDir,
+		"lang":            cfg.Lang,
+		"pin":             a.fileServer.GetPairingPIN(),
+		"https":           cfg.UseHTTPS,
+		"certFingerprint": a.fileServer.GetCertFingerprint(),
+	}
+}
+
+// SetUseHTTPS switches the upload server between HTTP and HTTPS and restarts it
+func (a *App) SetUseHTTPS(enabled bool) error {
+	err := a.updateConfig(func(cfg *Config) error {
+		cfg.UseHTTPS = enabled
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := a.fileServer.Restart(); err != nil {
+		log.Printf("Failed to restart HTTP server: %v", err)
+		return err
+	}
+	a.notifyPairingChanged()
+	return nil
+}
+
+// GetSessions returns the devices currently paired with the upload server
+func (a *App) GetSessions() []Session {
+	return a.fileServer.auth.List()
+}
+
+// RevokeSession revokes a paired device's session token
+func (a *App) RevokeSession(id string) error {
+	if !a.fileServer.auth.Revoke(id) {
+		return fmt.Errorf("session not found: %s", id)
+	}
+	a.notifyPairingChanged()
+	return nil
+}
+
+// RevokeAllSessions revokes every paired device and rotates the PIN and QR secret
+func (a *App) RevokeAllSessions() {
+	a.fileServer.auth.RevokeAll()
+	a.notifyPairingChanged()
+}
+
+// notifyPairingChanged tells the frontend to refresh the PIN, QR code and session list
+func (a *App) notifyPairingChanged() {
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "pairing:changed")
 	}
 }
 
 // GetSaveDir returns the current save directory
 func (a *App) GetSaveDir() string {
-	return a.config.SaveDir
+	return a.settings().SaveDir
 }
 
 // GetLang returns the current language setting
 func (a *App) GetLang() string {
-	return a.config.Lang
+	return a.settings().Lang
 }
 
 // SetLang changes the language and saves config
@@ -76,53 +175,343 @@ func (a *App) SetLang(lang string) error {
 	if lang != "ja" && lang != "en" {
 		lang = "ja"
 	}
-	a.config.Lang = lang
-	return SaveConfig(a.config)
+	return a.updateConfig(func(cfg *Config) error {
+		cfg.Lang = lang
+		return nil
+	})
 }
 
 // SelectSaveDir opens a folder selection dialog
 func (a *App) SelectSaveDir() (string, error) {
 	dir, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
 		Title:            "Select Save Folder",
-		DefaultDirectory: a.config.SaveDir,
+		DefaultDirectory: a.GetSaveDir(),
 	})
 	if err != nil {
 		return "", err
 	}
 	if dir == "" {
 		// User cancelled
-		return a.config.SaveDir, nil
+		return a.GetSaveDir(), nil
 	}
 
-	a.config.SaveDir = dir
-	if err := SaveConfig(a.config); err != nil {
+	err = a.updateConfig(func(cfg *Config) error {
+		cfg.SaveDir = dir
+		return nil
+	})
+	if err != nil {
 		log.Printf("Failed to save config: %v", err)
 	}
 
 	return dir, nil
 }
 
+// ShareFiles opens a file dialog and offers the selected files for download on the phone
+func (a *App) ShareFiles() ([]SharedFile, error) {
+	paths, err := runtime.OpenMultipleFilesDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select Files to Send",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.AddSharedFiles(paths)
+}
+
+// AddSharedFiles offers local files for download on the phone
+func (a *App) AddSharedFiles(paths []string) ([]SharedFile, error) {
+	ttl := time.Duration(a.settings().ShareExpiryMinutes) * time.Minute
+	added := make([]SharedFile, 0, len(paths))
+	for _, p := range paths {
+		item, err := a.fileServer.shelf.Add(p, ttl)
+		if err != nil {
+			log.Printf("Failed to share %s: %v", p, err)
+			continue
+		}
+		added = append(added, item)
+	}
+	if len(paths) > 0 && len(added) == 0 {
+		return nil, fmt.Errorf("none of the selected files could be shared")
+	}
+	return added, nil
+}
+
+// GetSharedFiles returns the files currently offered to the phone
+func (a *App) GetSharedFiles() []SharedFile {
+	return a.fileServer.shelf.List()
+}
+
+// RemoveSharedFile stops offering a file to the phone
+func (a *App) RemoveSharedFile(id string) error {
+	if !a.fileServer.shelf.Remove(id) {
+		return fmt.Errorf("shared file not found: %s", id)
+	}
+	return nil
+}
+
 // GetCompressSettings returns the current compression settings
 func (a *App) GetCompressSettings() map[string]interface{} {
+	cfg := a.settings()
 	return map[string]interface{}{
-		"compressImages": a.config.CompressImages,
-		"imageQuality":   a.config.ImageQuality,
-		"keepOriginal":   a.config.KeepOriginal,
+		"compressImages": cfg.CompressImages,
+		"imageQuality":   cfg.ImageQuality,
+		"keepOriginal":   cfg.KeepOriginal,
+		"maxDimension":   cfg.MaxDimension,
+		"heicOutput":     cfg.HEICOutput,
+		"convertHEIC":    cfg.ConvertHEIC,
+		"privacyMode":    cfg.PrivacyMode,
+		"outputFormat":   cfg.OutputFormat,
+		"pngToWebp":      cfg.PNGToWebP,
 	}
 }
 
 // SetCompressSettings updates the compression settings and saves config
-func (a *App) SetCompressSettings(compressImages bool, imageQuality int, keepOriginal bool) error {
+func (a *App) SetCompressSettings(compressImages bool, imageQuality int, keepOriginal bool, maxDimension int) error {
 	if imageQuality < 30 {
 		imageQuality = 30
 	}
 	if imageQuality > 95 {
 		imageQuality = 95
 	}
-	a.config.CompressImages = compressImages
-	a.config.ImageQuality = imageQuality
-	a.config.KeepOriginal = keepOriginal
-	return SaveConfig(a.config)
+	if maxDimension < 0 {
+		maxDimension = 0
+	}
+	return a.updateConfig(func(cfg *Config) error {
+		cfg.CompressImages = compressImages
+		cfg.ImageQuality = imageQuality
+		cfg.KeepOriginal = keepOriginal
+		cfg.MaxDimension = maxDimension
+		return nil
+	})
+}
+
+// SetHEICSettings sets how HEIC photos are saved: output is "jpeg" (convert
+// when compressing) or "keep", and alwaysConvert converts to JPEG even when
+// compression is off
+func (a *App) SetHEICSettings(output string, alwaysConvert bool) error {
+	if output != heicOutputKeep {
+		output = heicOutputJPEG
+	}
+	return a.updateConfig(func(cfg *Config) error {
+		cfg.HEICOutput = output
+		cfg.ConvertHEIC = alwaysConvert
+		return nil
+	})
+}
+
+// SetOutputFormat sets the format compressed images are saved in: "keep",
+// "jpeg", "webp" or "avif". pngLossless saves PNG as lossless WebP.
+func (a *App) SetOutputFormat(format string, pngLossless bool) error {
+	if !validOutputFormats[format] {
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+	return a.updateConfig(func(cfg *Config) error {
+		cfg.OutputFormat = format
+		cfg.PNGToWebP = pngLossless
+		return nil
+	})
+}
+
+// GetDuplicateMode returns how files already in the save folder are handled
+func (a *App) GetDuplicateMode() string {
+	return a.settings().DuplicateMode
+}
+
+// SetDuplicateMode sets how files already in the save folder are handled:
+// "keep" saves another copy, "skip" drops the upload, "link" hard-links it
+func (a *App) SetDuplicateMode(mode string) error {
+	if mode != duplicateKeep && mode != duplicateSkip && mode != duplicateLink {
+		return fmt.Errorf("unknown duplicate mode: %s", mode)
+	}
+	return a.updateConfig(func(cfg *Config) error {
+		cfg.DuplicateMode = mode
+		return nil
+	})
+}
+
+// GetConflictPolicy returns what happens when an uploaded file's name is taken
+func (a *App) GetConflictPolicy() string {
+	return a.settings().ConflictPolicy
+}
+
+// SetConflictPolicy sets what happens when an uploaded file's name is taken:
+// "rename", "overwrite", "skip", "timestamp" or "newer"
+func (a *App) SetConflictPolicy(policy string) error {
+	if !validConflictPolicies[policy] {
+		return fmt.Errorf("unknown conflict policy: %s", policy)
+	}
+	return a.updateConfig(func(cfg *Config) error {
+		cfg.ConflictPolicy = policy
+		return nil
+	})
+}
+
+// GetFolderTemplate returns the date subfolder template, "" when uploads
+// are saved directly in the save directory
+func (a *App) GetFolderTemplate() string {
+	return a.settings().FolderTemplate
+}
+
+// SetFolderTemplate sets the date subfolder template for uploads, using
+// {yyyy}, {yy}, {MM} and {dd}. Empty turns date sorting off.
+func (a *App) SetFolderTemplate(template string) error {
+	tmpl, err := parseFolderTemplate(template)
+	if err != nil {
+		return err
+	}
+	return a.updateConfig(func(cfg *Config) error {
+		cfg.FolderTemplate = tmpl
+		return nil
+	})
+}
+
+// GetRenameTemplate returns the template uploads are renamed with, "" when
+// they keep the names sent by the phone
+func (a *App) GetRenameTemplate() string {
+	return a.settings().RenameTemplate
+}
+
+// SetRenameTemplate sets the template uploads are renamed with, using
+// {date}, {time}, {device}, {original}, {counter}, {ext} and {hash8}. Empty
+// keeps the names sent by the phone.
+func (a *App) SetRenameTemplate(template string) error {
+	tmpl, err := parseRenameTemplate(template)
+	if err != nil {
+		return err
+	}
+	return a.updateConfig(func(cfg *Config) error {
+		cfg.RenameTemplate = tmpl
+		return nil
+	})
+}
+
+// PreviewRenameTemplate shows what a file named fileName would be saved as
+// with template, using sample values for the device, date and hash
+func (a *App) PreviewRenameTemplate(template, fileName string) (string, error) {
+	return previewRename(template, fileName)
+}
+
+// FileTypeLists are the MIME types and families accepted and refused
+type FileTypeLists struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// GetFileTypeLists returns the allowed and blocked file types
+func (a *App) GetFileTypeLists() FileTypeLists {
+	cfg := a.settings()
+	return FileTypeLists{
+		Allow: append([]string{}, cfg.AllowTypes...),
+		Deny:  append([]string{}, cfg.DenyTypes...),
+	}
+}
+
+// SetFileTypeLists sets the allowed and blocked file types, as MIME types
+// ("application/pdf"), families ("video/*") or "executable" and "script".
+// An empty allow list accepts everything not blocked.
+func (a *App) SetFileTypeLists(allow, deny []string) error {
+	allow, err := parseTypeList(allow)
+	if err != nil {
+		return err
+	}
+	deny, err = parseTypeList(deny)
+	if err != nil {
+		return err
+	}
+	return a.updateConfig(func(cfg *Config) error {
+		cfg.AllowTypes = allow
+		cfg.DenyTypes = deny
+		return nil
+	})
+}
+
+// GetUploadRules returns the upload rules in the order they are tried
+func (a *App) GetUploadRules() []UploadRule {
+	rules := a.settings().Rules
+	result := make([]UploadRule, len(rules))
+	copy(result, rules)
+	return result
+}
+
+// SaveUploadRule adds a rule at the end of the list, or replaces the rule
+// with the same ID. Returns the rule as saved.
+func (a *App) SaveUploadRule(rule UploadRule) (UploadRule, error) {
+	rule, err := validateRule(rule)
+	if err != nil {
+		return rule, err
+	}
+
+	err = a.updateConfig(func(cfg *Config) error {
+		rules := append([]UploadRule{}, cfg.Rules...)
+		replaced := false
+		for i := range rules {
+			if rule.ID != "" && rules[i].ID == rule.ID {
+				rules[i] = rule
+				replaced = true
+			}
+		}
+		if !replaced {
+			rule.ID = newRuleID()
+			rules = append(rules, rule)
+		}
+		cfg.Rules = rules
+		return nil
+	})
+	return rule, err
+}
+
+// DeleteUploadRule removes a rule
+func (a *App) DeleteUploadRule(id string) error {
+	return a.updateConfig(func(cfg *Config) error {
+		rules := make([]UploadRule, 0, len(cfg.Rules))
+		for _, r := range cfg.Rules {
+			if r.ID != id {
+				rules = append(rules, r)
+			}
+		}
+		cfg.Rules = rules
+		return nil
+	})
+}
+
+// MoveUploadRule moves a rule to position index, changing which rule wins
+// when several match
+func (a *App) MoveUploadRule(id string, index int) error {
+	return a.updateConfig(func(cfg *Config) error {
+		rules := append([]UploadRule{}, cfg.Rules...)
+		from := -1
+		for i, r := range rules {
+			if r.ID == id {
+				from = i
+			}
+		}
+		if from < 0 {
+			return fmt.Errorf("rule not found: %s", id)
+		}
+		if index < 0 || index >= len(rules) {
+			return fmt.Errorf("invalid rule position: %d", index)
+		}
+
+		rule := rules[from]
+		rules = append(rules[:from], rules[from+1:]...)
+		rules = append(rules[:index], append([]UploadRule{rule}, rules[index:]...)...)
+		cfg.Rules = rules
+		return nil
+	})
+}
+
+// TestUploadRules shows where a file with the given name, size and sending
+// device would be saved. The content type is guessed from the extension.
+func (a *App) TestUploadRules(fileName string, size int64, device string) RuleMatch {
+	return a.fileServer.testRules(fileName, size, device)
+}
+
+// SetPrivacyMode sets whether GPS and personal metadata are stripped from
+// received images. Applies even when compression is off.
+func (a *App) SetPrivacyMode(enabled bool) error {
+	return a.updateConfig(func(cfg *Config) error {
+		cfg.PrivacyMode = enabled
+		return nil
+	})
 }
 
 // GetUploadHistory returns the recent upload history
@@ -133,10 +522,19 @@ func (a *App) GetUploadHistory() []UploadRecord {
 	// Return a copy
 	result := make([]UploadRecord, len(a.history))
 	copy(result, a.history)
+	for i := range result {
+		result[i].Exists = fileExists(result[i].SavePath)
+	}
 	return result
 }
 
-// addUploadRecord adds a record to the upload history (max 10)
+// QueryUploadHistory searches the full upload history on disk
+func (a *App) QueryUploadHistory(query HistoryQuery) HistoryPage {
+	return a.store.Query(query)
+}
+
+// addUploadRecord adds a record to the upload history (max 10 in memory,
+// all of them on disk)
 func (a *App) addUploadRecord(record UploadRecord) {
 	a.historyMu.Lock()
 	defer a.historyMu.Unlock()
@@ -149,8 +547,24 @@ func (a *App) addUploadRecord(record UploadRecord) {
 		a.history = a.history[:10]
 	}
 
+	if err := a.store.Append(record); err != nil {
+		log.Printf("Failed to persist upload record: %v", err)
+	}
+
 	// Emit event to frontend
 	if a.ctx != nil {
 		runtime.EventsEmit(a.ctx, "upload:completed", record)
 	}
 }
+
+// emitCompressProgress reports a compression job state change to the frontend
+func (a *App) emitCompressProgress(job CompressJob) {
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "compress:progress", job)
+	}
+}
+
+// GetCompressQueue returns the images waiting for or being compressed
+func (a *App) GetCompressQueue() []CompressJob {
+	return a.fileServer.compress.Pending()
+}
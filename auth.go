@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionCookieName is the cookie that carries the session token
+const sessionCookieName = "fb_session"
+
+// sessionTTL is how long a paired session stays valid
+const sessionTTL = 12 * time.Hour
+
+// Wrong PINs from all devices together: after maxPinFailures within
+// pinFailureWindow, PIN pairing is locked for pinLockout. QR pairing keeps
+// working, and the PIN is not changed so the one on the desktop stays valid.
+const (
+	maxPinFailures   = 10
+	pinFailureWindow = 10 * time.Minute
+	pinLockout       = 10 * time.Minute
+)
+
+// After each wrong PIN an address waits before its next guess, starting at
+// pinBackoffBase and doubling up to pinBackoffMax
+const (
+	pinBackoffBase = time.Second
+	pinBackoffMax  = 5 * time.Minute
+)
+
+// Session describes a paired device
+type Session struct {
+	ID        string `json:"id"`
+	UserAgent string `json:"userAgent"`
+	Address   string `json:"address"`
+	Created   string `json:"created"`
+	Expires   string `json:"expires"`
+
+	expiresAt time.Time
+}
+
+// pinFailures tracks the wrong PINs sent from one address
+type pinFailures struct {
+	count int
+	last  time.Time // time of the last wrong PIN
+	until time.Time // no guess is checked before this
+}
+
+// sessionAuth issues and validates session tokens for paired devices.
+// Tokens have the form "<id>.<expiry>.<hmac>" and are signed with a key
+// generated at startup, so restarting the app invalidates all sessions.
+type sessionAuth struct {
+	mu         sync.Mutex
+	key        []byte
+	pin        string
+	pairSecret string
+	sessions   map[string]*Session
+	onChange   func()
+
+	pinFailures    map[string]*pinFailures // by address
+	windowStart    time.Time               // start of the current pinFailureWindow
+	windowFailures int                     // wrong PINs from anywhere since windowStart
+	lockedUntil    time.Time               // PIN pairing is refused before this
+}
+
+// newSessionAuth creates a session manager with a fresh signing key, PIN and pairing secret
+func newSessionAuth() *sessionAuth {
+	a := &sessionAuth{
+		key:         randomBytes(32),
+		sessions:    make(map[string]*Session),
+		pinFailures: make(map[string]*pinFailures),
+	}
+	a.rotatePairing()
+	return a
+}
+
+// randomBytes returns n cryptographically random bytes
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return b
+}
+
+// randomPIN returns a 6-digit numeric PIN
+func randomPIN() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+// rotatePairing replaces the PIN and the QR pairing secret. Caller must hold mu
+// or be the constructor.
+func (a *sessionAuth) rotatePairing() {
+	a.pin = randomPIN()
+	a.pairSecret = hex.EncodeToString(randomBytes(16))
+}
+
+// notify tells the desktop UI that pairing state changed
+func (a *sessionAuth) notify() {
+	if a.onChange != nil {
+		a.onChange()
+	}
+}
+
+// PIN returns the current pairing PIN
+func (a *sessionAuth) PIN() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.pin
+}
+
+// PairSecret returns the current one-time secret embedded in the QR URL
+func (a *sessionAuth) PairSecret() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.pairSecret
+}
+
+// sign returns the HMAC of a token payload
+func (a *sessionAuth) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// pairWithSecret issues a session if secret matches the QR pairing secret.
+// The secret is single-use and is rotated on success.
+func (a *sessionAuth) pairWithSecret(secret string, r *http.Request) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(a.pairSecret)) != 1 {
+		return "", false
+	}
+	a.rotatePairing()
+	token := a.issueLocked(r)
+	go a.notify()
+	return token, true
+}
+
+// pairWithPIN issues a session if pin matches. While the sending address is
+// backing off or PIN pairing is locked the guess is not checked, and the
+// time to wait is returned instead.
+func (a *sessionAuth) pairWithPIN(pin string, r *http.Request) (string, time.Duration, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	host := remoteHost(r)
+	if wait := a.pinWaitLocked(host, now); wait > 0 {
+		return "", wait, false
+	}
+	if pin == "" || subtle.ConstantTimeCompare([]byte(pin), []byte(a.pin)) != 1 {
+		a.pinFailedLocked(host, now)
+		return "", 0, false
+	}
+	delete(a.pinFailures, host)
+	a.rotatePairing()
+	token := a.issueLocked(r)
+	go a.notify()
+	return token, 0, true
+}
+
+// pinWaitLocked returns how long host must wait before its next PIN is
+// checked. Caller must hold mu.
+func (a *sessionAuth) pinWaitLocked(host string, now time.Time) time.Duration {
+	until := a.lockedUntil
+	if f := a.pinFailures[host]; f != nil && f.until.After(until) {
+		until = f.until
+	}
+	return until.Sub(now)
+}
+
+// pinFailedLocked records a wrong PIN from host, backing the address off and
+// locking PIN pairing when too many arrive. Caller must hold mu.
+func (a *sessionAuth) pinFailedLocked(host string, now time.Time) {
+	for h, f := range a.pinFailures {
+		if now.Sub(f.last) > pinFailureWindow && now.After(f.until) {
+			delete(a.pinFailures, h)
+		}
+	}
+	f := a.pinFailures[host]
+	if f == nil {
+		f = &pinFailures{}
+		a.pinFailures[host] = f
+	}
+	f.count++
+	f.last = now
+	backoff := pinBackoffMax
+	if f.count <= 16 {
+		backoff = min(pinBackoffBase<<(f.count-1), pinBackoffMax)
+	}
+	f.until = now.Add(backoff)
+	log.Printf("Wrong PIN from %s (%d in a row), next attempt in %v", host, f.count, backoff)
+
+	if now.Sub(a.windowStart) > pinFailureWindow {
+		a.windowStart = now
+		a.windowFailures = 0
+	}
+	a.windowFailures++
+	if a.windowFailures >= maxPinFailures {
+		log.Printf("Too many wrong PINs, locking PIN pairing for %v", pinLockout)
+		a.lockedUntil = now.Add(pinLockout)
+		a.windowFailures = 0
+	}
+}
+
+// issueLocked creates a new session and returns its signed token. Caller must hold mu.
+func (a *sessionAuth) issueLocked(r *http.Request) string {
+	now := time.Now()
+	expires := now.Add(sessionTTL)
+	id := hex.EncodeToString(randomBytes(12))
+
+	a.sessions[id] = &Session{
+		ID:        id,
+		UserAgent: r.UserAgent(),
+		Address:   remoteHost(r),
+		Created:   now.Format("2006-01-02 15:04:05"),
+		Expires:   expires.Format("2006-01-02 15:04:05"),
+		expiresAt: expires,
+	}
+	log.Printf("Device paired: session %s from %s", id, remoteHost(r))
+
+	payload := id + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + a.sign(payload)
+}
+
+// validate checks a token's signature, expiry and that it has not been revoked.
+// Returns the session ID on success.
+func (a *sessionAuth) validate(token string) (string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(a.sign(payload))) {
+		return "", false
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return "", false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.sessions[parts[0]]; !ok {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// List returns the active sessions, pruning expired ones
+func (a *sessionAuth) List() []Session {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	result := make([]Session, 0, len(a.sessions))
+	for id, s := range a.sessions {
+		if now.After(s.expiresAt) {
+			delete(a.sessions, id)
+			continue
+		}
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created > result[j].Created
+	})
+	return result
+}
+
+// Revoke removes a session so its token is no longer accepted
+func (a *sessionAuth) Revoke(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.sessions[id]; !ok {
+		return false
+	}
+	delete(a.sessions, id)
+	log.Printf("Session revoked: %s", id)
+	return true
+}
+
+// RevokeAll removes every session and rotates the pairing secrets
+func (a *sessionAuth) RevokeAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sessions = make(map[string]*Session)
+	a.rotatePairing()
+	log.Printf("All sessions revoked")
+}
+
+// remoteHost returns the client IP without the port
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestToken extracts the session token from the cookie or Authorization header
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if c, err := r.Cookie(sessionCookieName); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// setSessionCookie stores the session token on the client
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// requireSession wraps an API handler so it only runs for paired devices
+func (fs *FileServer) requireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := fs.auth.validate(requestToken(r)); !ok {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{
+				"error": "Not paired. Reload the page and enter the PIN shown on the PC.",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handlePair exchanges a PIN for a session cookie (POST /api/pair)
+func (fs *FileServer) handlePair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PIN string `json:"pin"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1024)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Invalid request",
+		})
+		return
+	}
+
+	token, wait, ok := fs.auth.pairWithPIN(strings.TrimSpace(req.PIN), r)
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((wait+time.Second-1)/time.Second), 10))
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{
+			"error": "Too many wrong PINs. Try again later.",
+		})
+		return
+	}
+	if !ok {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error": "Invalid PIN",
+		})
+		return
+	}
+
+	setSessionCookie(w, r, token)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"token":   token,
+	})
+}
+
+var pairPageTemplate = template.Must(template.New("pair").Parse(pairPageTmpl))
+
+// servePairPage renders the PIN entry page for unpaired devices
+func servePairPage(w http.ResponseWriter, texts uploadTexts) {
+	var buf bytes.Buffer
+	if err := pairPageTemplate.Execute(&buf, texts); err != nil {
+		log.Printf("Failed to render pair page: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(buf.Bytes())
+}
+
+// pairPageTmpl is the Go template for the PIN entry page
+const pairPageTmpl = `<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0, maximum-scale=1.0, user-scalable=no">
+<title>{{.PageTitle}}</title>
+<style>
+* { box-sizing: border-box; margin: 0; padding: 0; }
+body {
+  font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+  background: #0f172a;
+  color: #e2e8f0;
+  min-height: 100vh;
+  padding: 20px;
+}
+.container { max-width: 480px; margin: 0 auto; text-align: center; }
+h1 { font-size: 1.5rem; margin-bottom: 24px; color: #38bdf8; }
+p { color: #94a3b8; margin-bottom: 16px; font-size: 0.95rem; }
+input {
+  width: 100%;
+  padding: 14px;
+  font-size: 1.6rem;
+  letter-spacing: 0.4em;
+  text-align: center;
+  border-radius: 8px;
+  border: 2px solid #475569;
+  background: #1e293b;
+  color: #e2e8f0;
+  margin-bottom: 16px;
+}
+button {
+  display: block;
+  width: 100%;
+  padding: 16px;
+  background: #2563eb;
+  color: white;
+  border: none;
+  border-radius: 8px;
+  font-size: 1.1rem;
+}
+.status { margin-top: 16px; color: #f87171; min-height: 1.5em; }
+</style>
+</head>
+<body>
+<div class="container">
+  <h1>{{.Heading}}</h1>
+  <p>{{.PinPrompt}}</p>
+  <input id="pin" type="text" inputmode="numeric" autocomplete="one-time-code" maxlength="6">
+  <button id="pairBtn">{{.PairBtn}}</button>
+  <div class="status" id="status"></div>
+</div>
+<script>
+var T = {
+  pinInvalid: '{{.PinInvalid}}',
+  pinLocked: '{{.PinLocked}}',
+  networkError: '{{.NetworkError}}'
+};
+
+document.getElementById('pairBtn').addEventListener('click', function() {
+  var statusEl = document.getElementById('status');
+  var xhr = new XMLHttpRequest();
+  xhr.open('POST', '/api/pair');
+  xhr.setRequestHeader('Content-Type', 'application/json');
+  xhr.onload = function() {
+    if (xhr.status === 200) {
+      location.reload();
+    } else if (xhr.status === 429) {
+      statusEl.textContent = T.pinLocked;
+    } else {
+      statusEl.textContent = T.pinInvalid;
+    }
+  };
+  xhr.onerror = function() { statusEl.textContent = T.networkError; };
+  xhr.send(JSON.stringify({ pin: document.getElementById('pin').value }));
+});
+</script>
+</body>
+</html>`
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// errChecksumMismatch is returned when received data does not match the
+// SHA-256 the phone computed
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// parseChecksum normalizes a hex SHA-256 sent by a client. An empty value
+// means the client did not send one.
+func parseChecksum(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return "", nil
+	}
+	if b, err := hex.DecodeString(s); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 checksum")
+	}
+	return s, nil
+}
+
+// verifyChecksum compares a computed hash with the expected one, if any
+func verifyChecksum(h hash.Hash, expected string) (string, error) {
+	sum := hex.EncodeToString(h.Sum(nil))
+	if expected != "" && sum != expected {
+		return sum, fmt.Errorf("%w: expected %s, got %s", errChecksumMismatch, expected, sum)
+	}
+	return sum, nil
+}
+
+// loadHashState restores the running hash of a staged upload. The state file
+// holds the number of bytes hashed followed by the marshaled hash; if it does
+// not cover exactly offset bytes the part file is hashed again from the start.
+func loadHashState(statePath, partPath string, offset int64) (hash.Hash, error) {
+	h := sha256.New()
+	if data, err := os.ReadFile(statePath); err == nil && len(data) > 8 && int64(binary.BigEndian.Uint64(data)) == offset {
+		if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(data[8:]); err == nil {
+			return h, nil
+		}
+		h.Reset()
+	}
+
+	f, err := os.Open(partPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := io.CopyN(h, f, offset); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// saveHashState stores the running hash of a staged upload after offset bytes
+func saveHashState(statePath string, h hash.Hash, offset int64) error {
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data := binary.BigEndian.AppendUint64(nil, uint64(offset))
+	return os.WriteFile(statePath, append(data, state...), 0644)
+}
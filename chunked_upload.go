@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stagingDirName is the directory under the save directory that holds partial uploads
+const stagingDirName = ".filebridge-staging"
+
+// maxRejectedDrain is how much of a refused chunk is read and discarded so the
+// phone sees the 415 rather than a reset connection. More than one chunk of
+// the upload page.
+const maxRejectedDrain = 16 << 20
+
+// stagedUploadTTL is how long an unfinished upload is kept before it is discarded
+const stagedUploadTTL = 24 * time.Hour
+
+// stagedUpload describes a resumable upload in progress
+type stagedUpload struct {
+	ID       string `json:"id"`
+	FileName string `json:"fileName"`
+	Length   int64  `json:"length"`
+	Created  int64  `json:"created"`
+	Device   string `json:"device,omitempty"`
+	Checksum string `json:"checksum,omitempty"` // SHA-256 computed by the phone
+	Conflict string `json:"conflict,omitempty"` // conflict policy chosen by the uploader
+	Folder   string `json:"folder,omitempty"`   // sanitized folder of a folder upload
+	ModTime  int64  `json:"modTime,omitempty"`  // modification time on the phone (ms)
+}
+
+// chunkedUploads tracks resumable uploads that are currently receiving data
+type chunkedUploads struct {
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+// newChunkedUploads creates an empty resumable upload tracker
+func newChunkedUploads() *chunkedUploads {
+	return &chunkedUploads{active: make(map[string]bool)}
+}
+
+// acquire marks an upload as busy. Returns false if another request holds it.
+func (c *chunkedUploads) acquire(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active[id] {
+		return false
+	}
+	c.active[id] = true
+	return true
+}
+
+// release marks an upload as idle again
+func (c *chunkedUploads) release(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.active, id)
+}
+
+// stagingDir returns the staging directory for the given save directory
+func stagingDir(saveDir string) string {
+	return filepath.Join(saveDir, stagingDirName)
+}
+
+// stagedPaths returns the info and data file paths of a staged upload
+func stagedPaths(saveDir, id string) (infoPath, partPath string) {
+	dir := stagingDir(saveDir)
+	return filepath.Join(dir, id+".json"), filepath.Join(dir, id+".part")
+}
+
+// stagedHashPath returns the path of the running SHA-256 state of a staged upload
+func stagedHashPath(saveDir, id string) string {
+	return filepath.Join(stagingDir(saveDir), id+".sha256")
+}
+
+// validUploadID checks that an upload ID is a hex string we could have issued
+func validUploadID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// newUploadID returns a random upload ID
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// loadStagedUpload reads the info of a staged upload and its current offset
+func loadStagedUpload(saveDir, id string) (*stagedUpload, int64, error) {
+	infoPath, partPath := stagedPaths(saveDir, id)
+
+	data, err := os.ReadFile(infoPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	info := &stagedUpload{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, 0, err
+	}
+
+	st, err := os.Stat(partPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	return info, st.Size(), nil
+}
+
+// removeStagedUpload deletes the files of a staged upload
+func removeStagedUpload(saveDir, id string) {
+	infoPath, partPath := stagedPaths(saveDir, id)
+	os.Remove(partPath)
+	os.Remove(infoPath)
+	os.Remove(stagedHashPath(saveDir, id))
+}
+
+// writeStagedInfo writes the info of a staged upload through a temp file, so
+// it is never seen half-written
+func writeStagedInfo(saveDir string, info stagedUpload) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(stagingDir(saveDir), "info-*"+tempUploadSuffix)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		infoPath, _ := stagedPaths(saveDir, info.ID)
+		err = os.Rename(f.Name(), infoPath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// cleanupStagedUploads removes staged uploads older than stagedUploadTTL, and
+// temp files and parts without info that have not been written to for as
+// long. Anything newer is left alone, as it may belong to an upload that is
+// still being created by another request.
+func cleanupStagedUploads(saveDir string) {
+	dir := stagingDir(saveDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-stagedUploadTTL)
+	stale := func(e os.DirEntry) bool {
+		st, err := e.Info()
+		return err == nil && st.ModTime().Before(cutoff)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		switch ext := filepath.Ext(name); ext {
+		case ".json":
+			id := strings.TrimSuffix(name, ext)
+			info, _, err := loadStagedUpload(saveDir, id)
+			if err == nil && !time.Unix(info.Created, 0).Before(cutoff) {
+				continue
+			}
+			if err != nil && !stale(e) {
+				continue
+			}
+			log.Printf("Removing stale staged upload %s", id)
+			removeStagedUpload(saveDir, id)
+
+		case ".part", ".sha256":
+			// Orphaned by an upload whose info was lost
+			id := strings.TrimSuffix(name, ext)
+			if _, err := os.Stat(filepath.Join(dir, id+".json")); err == nil || !stale(e) {
+				continue
+			}
+			log.Printf("Removing orphaned staged file %s", name)
+			os.Remove(filepath.Join(dir, name))
+
+		case tempUploadSuffix:
+			// Left behind by an upload that was cut off mid-write
+			if stale(e) {
+				os.Remove(filepath.Join(dir, name))
+			}
+		}
+	}
+}
+
+// parseUploadMetadata parses a tus-style Upload-Metadata header
+// ("key base64value,key2 base64value2")
+func parseUploadMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 {
+			continue
+		}
+		value := ""
+		if len(parts) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		meta[parts[0]] = value
+	}
+	return meta
+}
+
+// handleCreateUpload creates a new resumable upload (POST /api/uploads).
+// The client sends Upload-Length and Upload-Metadata (filename) headers and
+// receives the upload location to PATCH chunks to.
+func (fs *FileServer) handleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	saveDir := fs.app.GetSaveDir()
+	if saveDir == "" {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "Save directory not configured",
+		})
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Missing or invalid Upload-Length",
+		})
+		return
+	}
+	if length > maxUploadSize {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+			"error": "File is too large (max 2GB).",
+		})
+		return
+	}
+
+	meta := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	safeName := sanitizeFilename(meta["filename"])
+	folder := ""
+	if rel := meta["relativePath"]; rel != "" {
+		if folder, safeName, err = sanitizeRelativePath(rel); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	checksum, err := parseChecksum(meta["sha256"])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Invalid sha256 in Upload-Metadata",
+		})
+		return
+	}
+	conflict, err := parseConflictPolicy(meta["conflict"])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := os.MkdirAll(stagingDir(saveDir), 0755); err != nil {
+		log.Printf("Failed to create staging directory: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "Failed to create staging directory",
+		})
+		return
+	}
+	cleanupStagedUploads(saveDir)
+
+	id, err := newUploadID()
+	if err != nil {
+		log.Printf("Failed to generate upload ID: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "Failed to create upload",
+		})
+		return
+	}
+
+	info := stagedUpload{
+		ID:       id,
+		FileName: safeName,
+		Length:   length,
+		Created:  time.Now().Unix(),
+		Device:   deviceLabel(r),
+		Checksum: checksum,
+		Conflict: conflict,
+		Folder:   folder,
+	}
+	if modTime := parseModTime(meta["lastModified"]); !modTime.IsZero() {
+		info.ModTime = modTime.UnixMilli()
+	}
+	// The part comes first and the info appears whole, so an upload is
+	// never seen without its data
+	_, partPath := stagedPaths(saveDir, id)
+	if err := os.WriteFile(partPath, nil, 0644); err != nil {
+		log.Printf("Failed to create staged upload file: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "Failed to create upload",
+		})
+		return
+	}
+	if err := writeStagedInfo(saveDir, info); err != nil {
+		os.Remove(partPath)
+		log.Printf("Failed to write staged upload info: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "Failed to create upload",
+		})
+		return
+	}
+
+	log.Printf("Resumable upload created: %s (%s, %d bytes)", id, safeName, length)
+
+	location := "/api/uploads/" + id
+	w.Header().Set("Location", location)
+	w.Header().Set("Upload-Offset", "0")
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":       id,
+		"location": location,
+	})
+}
+
+// handleResumableUpload serves HEAD (query offset), PATCH (append chunk)
+// and DELETE (abort) for /api/uploads/{id}
+func (fs *FileServer) handleResumableUpload(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !validUploadID(id) {
+		http.NotFound(w, r)
+		return
+	}
+
+	saveDir := fs.app.GetSaveDir()
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case http.MethodHead:
+		info, offset, err := loadStagedUpload(saveDir, id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodPatch:
+		fs.handleUploadChunk(w, r, saveDir, id)
+
+	case http.MethodDelete:
+		if !fs.chunked.acquire(id) {
+			writeJSON(w, http.StatusLocked, map[string]string{
+				"error": "Upload is busy",
+			})
+			return
+		}
+		defer fs.chunked.release(id)
+		removeStagedUpload(saveDir, id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUploadChunk appends the request body to a staged upload at Upload-Offset
+// and finishes the upload once all bytes have arrived
+func (fs *FileServer) handleUploadChunk(w http.ResponseWriter, r *http.Request, saveDir, id string) {
+	if !fs.chunked.acquire(id) {
+		// A previous request for this upload may still be draining after a disconnect
+		writeJSON(w, http.StatusLocked, map[string]string{
+			"error": "Upload is busy",
+		})
+		return
+	}
+	defer fs.chunked.release(id)
+
+	info, offset, err := loadStagedUpload(saveDir, id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "Upload not found",
+		})
+		return
+	}
+
+	clientOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || clientOffset != offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":  "Upload-Offset mismatch",
+			"offset": offset,
+		})
+		return
+	}
+
+	// Never accept more than the declared length. Whatever arrives before a
+	// disconnect is kept so the client can resume from there.
+	remaining := info.Length - offset
+	body := io.LimitReader(r.Body, remaining)
+	if offset == 0 {
+		// Check the file type on the first chunk instead of after the whole file
+		head := make([]byte, min(remaining, sniffLen))
+		n, _ := io.ReadFull(body, head)
+		if n == len(head) {
+			if err := fs.checkUploadHead(info.FileName, head); err != nil {
+				rejection, _ := asRejected(err)
+				log.Printf("Rejected upload %s (%s): %v", id, info.FileName, err)
+				removeStagedUpload(saveDir, id)
+				io.CopyN(io.Discard, body, maxRejectedDrain)
+				writeJSON(w, http.StatusUnsupportedMediaType, map[string]interface{}{
+					"error":    rejection.Reason,
+					"rejected": rejection,
+				})
+				return
+			}
+		}
+		body = io.MultiReader(bytes.NewReader(head[:n]), body)
+	}
+
+	_, partPath := stagedPaths(saveDir, id)
+	hashPath := stagedHashPath(saveDir, id)
+	h, err := loadHashState(hashPath, partPath, offset)
+	if err != nil {
+		log.Printf("Failed to hash staged upload %s: %v", id, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "Failed to open upload",
+		})
+		return
+	}
+
+	dst, err := os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("Failed to open staged upload %s: %v", id, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "Failed to open upload",
+		})
+		return
+	}
+
+	written, copyErr := io.Copy(io.MultiWriter(dst, h), body)
+	closeErr := dst.Close()
+	offset += written
+	if err := saveHashState(hashPath, h, offset); err != nil {
+		// Not fatal: the next chunk hashes the part file again
+		log.Printf("Failed to save hash state for upload %s: %v", id, err)
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+
+	if copyErr != nil || closeErr != nil {
+		log.Printf("Chunk interrupted for upload %s at offset %d: %v", id, offset, copyErr)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error":  "Chunk interrupted",
+			"offset": offset,
+		})
+		return
+	}
+
+	if offset < info.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	sum, err := verifyChecksum(h, info.Checksum)
+	if err != nil {
+		log.Printf("Rejecting upload %s (%s): %v", id, info.FileName, err)
+		removeStagedUpload(saveDir, id)
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": "File was corrupted in transfer (checksum mismatch). Please send it again.",
+		})
+		return
+	}
+
+	record, err := fs.finishStagedUpload(saveDir, info, sum)
+	if rejection, ok := asRejected(err); ok {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]interface{}{
+			"error":    rejection.Reason,
+			"rejected": rejection,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to finish upload %s: %v", id, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "Failed to save file",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"offset":  offset,
+		"file":    record,
+	})
+}
+
+// finishStagedUpload moves a completed upload out of the staging area into
+// the save directory, going through compression and metadata stripping when enabled
+func (fs *FileServer) finishStagedUpload(saveDir string, info *stagedUpload, sum string) (UploadRecord, error) {
+	_, partPath := stagedPaths(saveDir, info.ID)
+	defer removeStagedUpload(saveDir, info.ID)
+
+	// Staging lives under the save directory, so the file is renamed into place
+	meta := uploadMeta{
+		Name:     info.FileName,
+		Device:   info.Device,
+		SHA256:   sum,
+		Conflict: info.Conflict,
+		Folder:   info.Folder,
+	}
+	if info.ModTime > 0 {
+		meta.ModTime = time.UnixMilli(info.ModTime)
+	}
+	return fs.storeUpload(saveDir, meta, partPath)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestFileServer returns a file server saving into a temp directory,
+// with the history kept in another
+func newTestFileServer(t *testing.T, cfg Config) (*FileServer, string) {
+	t.Helper()
+	cfg.SaveDir = t.TempDir()
+	app := &App{
+		config:    &cfg,
+		store:     &historyStore{path: filepath.Join(t.TempDir(), historyFileName)},
+		headless:  true,
+		approvals: newDeviceApprovals(),
+	}
+	app.fileServer = NewFileServer(app)
+	t.Cleanup(app.fileServer.compress.Close)
+	return app.fileServer, cfg.SaveDir
+}
+
+// createUpload starts a resumable upload and returns its ID
+func createUpload(t *testing.T, fs *FileServer, length int, meta map[string]string) string {
+	t.Helper()
+	var pairs []string
+	for k, v := range meta {
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/uploads", nil)
+	req.Header.Set("Upload-Length", strconv.Itoa(length))
+	req.Header.Set("Upload-Metadata", strings.Join(pairs, ","))
+	rec := httptest.NewRecorder()
+	fs.handleCreateUpload(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct{ ID string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.ID
+}
+
+// uploadRequest sends method to a resumable upload
+func uploadRequest(fs *FileServer, method, id string, offset int, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/uploads/"+id, bytes.NewReader(body))
+	req.SetPathValue("id", id)
+	if method == http.MethodPatch {
+		req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	}
+	rec := httptest.NewRecorder()
+	fs.handleResumableUpload(rec, req)
+	return rec
+}
+
+// stagedFiles lists the files in the staging directory
+func stagedFiles(t *testing.T, saveDir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(stagingDir(saveDir))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestResumableUpload(t *testing.T) {
+	fs, saveDir := newTestFileServer(t, Config{})
+	data := []byte("hello, resumable world")
+	sum := sha256.Sum256(data)
+	id := createUpload(t, fs, len(data), map[string]string{
+		"filename": "notes.txt",
+		"sha256":   hex.EncodeToString(sum[:]),
+	})
+
+	offsetOf := func(rec *httptest.ResponseRecorder) string {
+		return rec.Header().Get("Upload-Offset")
+	}
+
+	if rec := uploadRequest(fs, http.MethodHead, id, 0, nil); rec.Code != http.StatusOK || offsetOf(rec) != "0" {
+		t.Fatalf("HEAD: status %d, offset %q", rec.Code, offsetOf(rec))
+	}
+
+	// A chunk at the wrong offset is refused and the server says where to resume
+	rec := uploadRequest(fs, http.MethodPatch, id, 5, data[5:10])
+	if rec.Code != http.StatusConflict || offsetOf(rec) != "0" {
+		t.Fatalf("PATCH at wrong offset: status %d, offset %q", rec.Code, offsetOf(rec))
+	}
+
+	rec = uploadRequest(fs, http.MethodPatch, id, 0, data[:10])
+	if rec.Code != http.StatusNoContent || offsetOf(rec) != "10" {
+		t.Fatalf("first chunk: status %d, offset %q", rec.Code, offsetOf(rec))
+	}
+
+	// Resending the first chunk, as after a lost response, is refused
+	rec = uploadRequest(fs, http.MethodPatch, id, 0, data[:10])
+	if rec.Code != http.StatusConflict || offsetOf(rec) != "10" {
+		t.Fatalf("repeated chunk: status %d, offset %q", rec.Code, offsetOf(rec))
+	}
+	if rec := uploadRequest(fs, http.MethodHead, id, 0, nil); offsetOf(rec) != "10" {
+		t.Fatalf("HEAD after first chunk: offset %q", offsetOf(rec))
+	}
+
+	// Bytes past the declared length are not stored
+	rec = uploadRequest(fs, http.MethodPatch, id, 10, append(bytes.Clone(data[10:]), "extra"...))
+	if rec.Code != http.StatusOK || offsetOf(rec) != strconv.Itoa(len(data)) {
+		t.Fatalf("last chunk: status %d, offset %q: %s", rec.Code, offsetOf(rec), rec.Body)
+	}
+
+	saved, err := os.ReadFile(filepath.Join(saveDir, "notes.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved, data) {
+		t.Errorf("saved %q, want %q", saved, data)
+	}
+	if files := stagedFiles(t, saveDir); len(files) != 0 {
+		t.Errorf("staging not cleaned up: %v", files)
+	}
+	if rec := uploadRequest(fs, http.MethodHead, id, 0, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("HEAD after completion: status %d", rec.Code)
+	}
+}
+
+func TestResumableUploadChecksumMismatch(t *testing.T) {
+	fs, saveDir := newTestFileServer(t, Config{})
+	sum := sha256.Sum256([]byte("something else"))
+	id := createUpload(t, fs, 5, map[string]string{
+		"filename": "notes.txt",
+		"sha256":   hex.EncodeToString(sum[:]),
+	})
+
+	if rec := uploadRequest(fs, http.MethodPatch, id, 0, []byte("hello")); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if _, err := os.Stat(filepath.Join(saveDir, "notes.txt")); !os.IsNotExist(err) {
+		t.Error("corrupted file was saved")
+	}
+	if files := stagedFiles(t, saveDir); len(files) != 0 {
+		t.Errorf("staging not cleaned up: %v", files)
+	}
+}
+
+func TestResumableUploadRejectsFirstChunk(t *testing.T) {
+	fs, saveDir := newTestFileServer(t, Config{DenyTypes: []string{"executable"}})
+	program := append([]byte("MZ"), make([]byte, 2*sniffLen)...)
+	id := createUpload(t, fs, len(program), map[string]string{"filename": "photo.jpg"})
+
+	// Refused on the first chunk, before the rest of the file is sent
+	rec := uploadRequest(fs, http.MethodPatch, id, 0, program[:sniffLen])
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+	var resp struct{ Rejected RejectedUpload }
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Rejected.ContentType != "application/x-msdownload" {
+		t.Errorf("rejected content type %q", resp.Rejected.ContentType)
+	}
+	if files := stagedFiles(t, saveDir); len(files) != 0 {
+		t.Errorf("staging not cleaned up: %v", files)
+	}
+	if rec := uploadRequest(fs, http.MethodHead, id, 0, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("HEAD after rejection: status %d", rec.Code)
+	}
+}
+
+func TestResumableUploadUnknownID(t *testing.T) {
+	fs, _ := newTestFileServer(t, Config{})
+	for _, id := range []string{strings.Repeat("ab", 16), "../../etc", "short"} {
+		if rec := uploadRequest(fs, http.MethodPatch, id, 0, []byte("x")); rec.Code != http.StatusNotFound {
+			t.Errorf("PATCH %q: status %d", id, rec.Code)
+		}
+	}
+}
+
+func TestCleanupStagedUploads(t *testing.T) {
+	saveDir := t.TempDir()
+	dir := stagingDir(saveDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-stagedUploadTTL - time.Hour)
+	write := func(name string, modTime time.Time) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stage := func(id string, created time.Time) {
+		t.Helper()
+		write(id+".part", time.Now())
+		if err := writeStagedInfo(saveDir, stagedUpload{ID: id, FileName: "a.jpg", Length: 2, Created: created.Unix()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	active := strings.Repeat("1", 32)
+	expired := strings.Repeat("2", 32)
+	stage(active, time.Now())
+	stage(expired, old)
+	write(expired+".sha256", time.Now())
+	write(strings.Repeat("3", 32)+".part", time.Now()) // orphan being created
+	write(strings.Repeat("4", 32)+".part", old)        // stale orphan
+	write(strings.Repeat("5", 32)+".sha256", old)      // stale orphan
+	write("upload-1"+tempUploadSuffix, time.Now())
+	write("upload-2"+tempUploadSuffix, old)
+
+	cleanupStagedUploads(saveDir)
+
+	want := []string{
+		active + ".json",
+		active + ".part",
+		strings.Repeat("3", 32) + ".part",
+		"upload-1" + tempUploadSuffix,
+	}
+	if got := stagedFiles(t, saveDir); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("staging after cleanup = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// compressQueueSize is the number of compression jobs that can wait for a
+// worker before uploads block
+const compressQueueSize = 512
+
+// Compression job states reported to the desktop
+const (
+	compressQueued  = "queued"
+	compressRunning = "compressing"
+	compressDone    = "done"
+	compressFailed  = "failed"
+)
+
+// CompressJob is the progress of one image in the compression queue
+type CompressJob struct {
+	ID       int64         `json:"id"`
+	FileName string        `json:"fileName"`
+	Device   string        `json:"device,omitempty"`
+	State    string        `json:"state"`
+	Pending  int           `json:"pending"` // jobs queued or running, including this one
+	Record   *UploadRecord `json:"record,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// compressTask is a queued job with the file it works on
+type compressTask struct {
+	job     CompressJob
+	saveDir string
+	meta    uploadMeta
+	path    string
+}
+
+// compressQueue runs image compression on a pool of workers sized to the CPU
+// count, so upload requests can return before the encoding is done. How many
+// images are decoded at once is limited by decodePixelBudget.
+type compressQueue struct {
+	closeMu sync.RWMutex // held for reading while sending, for writing when closing
+	closed  bool
+	tasks   chan *compressTask
+	workers sync.WaitGroup
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]*CompressJob
+
+	run    func(t *compressTask) (UploadRecord, error)
+	notify func(job CompressJob)
+}
+
+// newCompressQueue starts the workers. run saves one file; notify receives
+// every state change.
+func newCompressQueue(run func(t *compressTask) (UploadRecord, error), notify func(job CompressJob)) *compressQueue {
+	q := &compressQueue{
+		tasks:   make(chan *compressTask, compressQueueSize),
+		pending: make(map[int64]*CompressJob),
+		run:     run,
+		notify:  notify,
+	}
+	for i := 0; i < runtime.NumCPU(); i++ {
+		q.workers.Add(1)
+		go q.worker()
+	}
+	return q
+}
+
+// Enqueue adds a file to the queue. The queue owns path from then on.
+// Returns false once the queue has been closed.
+func (q *compressQueue) Enqueue(saveDir string, meta uploadMeta, path string) (CompressJob, bool) {
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+	if q.closed {
+		return CompressJob{}, false
+	}
+
+	q.mu.Lock()
+	q.nextID++
+	job := &CompressJob{ID: q.nextID, FileName: meta.Name, Device: meta.Device, State: compressQueued}
+	q.pending[job.ID] = job
+	job.Pending = len(q.pending)
+	snapshot := *job
+	q.mu.Unlock()
+
+	q.notify(snapshot)
+	q.tasks <- &compressTask{job: snapshot, saveDir: saveDir, meta: meta, path: path}
+	return snapshot, true
+}
+
+// worker processes tasks until the queue is closed and drained
+func (q *compressQueue) worker() {
+	defer q.workers.Done()
+	for t := range q.tasks {
+		q.update(t.job.ID, func(job *CompressJob) { job.State = compressRunning })
+
+		record, err := q.run(t)
+
+		q.update(t.job.ID, func(job *CompressJob) {
+			if err != nil {
+				job.State = compressFailed
+				job.Error = err.Error()
+			} else {
+				job.State = compressDone
+				job.Record = &record
+			}
+		})
+	}
+}
+
+// update changes a job and reports it. Finished jobs leave the pending list.
+func (q *compressQueue) update(id int64, change func(job *CompressJob)) {
+	q.mu.Lock()
+	job, ok := q.pending[id]
+	if !ok {
+		q.mu.Unlock()
+		return
+	}
+	change(job)
+	if job.State == compressDone || job.State == compressFailed {
+		delete(q.pending, id)
+	}
+	job.Pending = len(q.pending)
+	snapshot := *job
+	q.mu.Unlock()
+
+	q.notify(snapshot)
+}
+
+// Pending returns the jobs that are queued or running, oldest first
+func (q *compressQueue) Pending() []CompressJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result := make([]CompressJob, 0, len(q.pending))
+	for _, job := range q.pending {
+		result = append(result, *job)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Close stops accepting jobs and waits for the queued ones to finish
+func (q *compressQueue) Close() {
+	q.closeMu.Lock()
+	if q.closed {
+		q.closeMu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.tasks)
+	q.closeMu.Unlock()
+
+	if n := len(q.Pending()); n > 0 {
+		log.Printf("Waiting for %d compression job(s) to finish", n)
+	}
+	q.workers.Wait()
+}
+
+// queueCompression hands a received image to the compression queue. The file
+// is moved to a temp name owned by the job so the caller can clean up as usual.
+// Returns false if the file should be processed right away instead.
+func (fs *FileServer) queueCompression(saveDir string, meta uploadMeta, tmpPath string) (UploadRecord, bool) {
+	f, err := os.CreateTemp(stagingDir(saveDir), "compress-*"+tempUploadSuffix)
+	if err != nil {
+		return UploadRecord{}, false
+	}
+	f.Close()
+	jobPath := f.Name()
+	if err := os.Rename(tmpPath, jobPath); err != nil {
+		os.Remove(jobPath)
+		return UploadRecord{}, false
+	}
+
+	st, _ := os.Stat(jobPath)
+	job, ok := fs.compress.Enqueue(saveDir, meta, jobPath)
+	if !ok {
+		// Shutting down: give the file back to the caller
+		if err := os.Rename(jobPath, tmpPath); err != nil {
+			log.Printf("Failed to return %s from the compression queue: %v", meta.Name, err)
+		}
+		return UploadRecord{}, false
+	}
+
+	record := UploadRecord{
+		FileName:    meta.Name,
+		Timestamp:   time.Now().Format("2006-01-02 15:04:05"),
+		Device:      meta.Device,
+		Status:      compressQueued,
+		SHA256:      meta.SHA256,
+		Folder:      meta.Folder,
+		Rule:        meta.Rule,
+		ContentType: meta.ContentType,
+		ExtMismatch: meta.ExtMismatch,
+	}
+	if st != nil {
+		record.Size = st.Size()
+	}
+	log.Printf("Queued %s for compression (job %d, %d pending)", meta.Name, job.ID, job.Pending)
+	return record, true
+}
+
+// runCompressTask saves a queued image, compressing it on the way
+func (fs *FileServer) runCompressTask(t *compressTask) (UploadRecord, error) {
+	return fs.saveUpload(t.saveDir, t.meta, t.path)
+}
@@ -5,28 +5,140 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 )
 
 // Config represents the application configuration
 type Config struct {
-	SaveDir        string `json:"saveDir"`
-	Lang           string `json:"lang"`
-	CompressImages bool   `json:"compressImages"`
-	ImageQuality   int    `json:"imageQuality"`
-	KeepOriginal   bool   `json:"keepOriginal"`
+	SaveDir        string   `json:"saveDir"`
+	Lang           string   `json:"lang"`
+	CompressImages bool     `json:"compressImages"`
+	ImageQuality   int      `json:"imageQuality"`
+	KeepOriginal   bool     `json:"keepOriginal"`
+	MaxDimension   int      `json:"maxImageDimension"`    // long edge in pixels, 0 = no resizing
+	HEICOutput     string   `json:"heicOutput"`           // heicOutputJPEG or heicOutputKeep; wins over OutputFormat
+	ConvertHEIC    bool     `json:"convertHEIC"`          // convert HEIC to JPEG even when compression is off
+	PrivacyMode    bool     `json:"privacyMode"`          // strip GPS and personal metadata from images
+	OutputFormat   string   `json:"outputFormat"`         // outputFormatKeep, JPEG, WebP or AVIF
+	PNGToWebP      bool     `json:"pngToWebpLossless"`    // save PNG as lossless WebP
+	DuplicateMode  string   `json:"duplicateMode"`        // duplicateKeep, duplicateSkip or duplicateLink
+	ConflictPolicy string   `json:"conflictPolicy"`       // what to do when the file name is taken
+	FolderTemplate string   `json:"folderTemplate"`       // date subfolder such as "{yyyy}/{MM}/{dd}", "" = none
+	RenameTemplate string   `json:"renameTemplate"`       // file name such as "{date}_{time}_{original}", "" = keep
+	AllowTypes     []string `json:"allowTypes,omitempty"` // MIME types or families accepted, empty = all
+	DenyTypes      []string `json:"denyTypes,omitempty"`  // MIME types or families refused, e.g. "executable"
+	UseHTTPS       bool     `json:"useHTTPS"`
+	AutoCopyText   bool     `json:"autoCopyText"`
+
+	ShareExpiryMinutes int `json:"shareExpiryMinutes"`
+
+	ApprovedDevices []ApprovedDevice `json:"approvedDevices,omitempty"`
+
+	Rules []UploadRule `json:"rules,omitempty"` // upload routing, first match wins
 }
 
 // configFileName is the config file name
 const configFileName = "config.json"
 
-// getConfigDir returns the config directory path
+// configDirName is the directory created under the OS config location
+const configDirName = "FileBridge"
+
+// configDirOverride is set by --config and replaces the OS config location
+var configDirOverride string
+
+// migrateOnce guards the move from the legacy config location
+var migrateOnce sync.Once
+
+// setConfigDir overrides the config directory. Must be called before NewApp.
+func setConfigDir(dir string) {
+	configDirOverride = dir
+}
+
+// getConfigDir returns the config directory path: %APPDATA% on Windows,
+// ~/Library/Application Support on macOS and $XDG_CONFIG_HOME (~/.config)
+// elsewhere, unless overridden with --config
 func getConfigDir() string {
-	appData := os.Getenv("APPDATA")
-	if appData == "" {
+	if configDirOverride != "" {
+		return configDirOverride
+	}
+
+	base, err := os.UserConfigDir()
+	if err != nil {
 		home, _ := os.UserHomeDir()
-		appData = filepath.Join(home, "AppData", "Roaming")
+		base = filepath.Join(home, ".config")
 	}
-	return filepath.Join(appData, "FileBridge")
+	dir := filepath.Join(base, configDirName)
+
+	migrateOnce.Do(func() {
+		migrateLegacyConfigDir(dir)
+	})
+	return dir
+}
+
+// legacyConfigDir is where older versions stored the config when APPDATA was
+// not set, i.e. on Linux and macOS
+func legacyConfigDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, "AppData", "Roaming", configDirName)
+}
+
+// migrateLegacyConfigDir moves config, history and certificates from the
+// legacy location to dir, once. Files already present in dir are kept.
+func migrateLegacyConfigDir(dir string) {
+	if runtime.GOOS == "windows" {
+		// Windows always used %APPDATA%, which is still the location
+		return
+	}
+	legacy := legacyConfigDir()
+	if legacy == dir {
+		return
+	}
+	entries, err := os.ReadDir(legacy)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Failed to create config directory %s: %v", dir, err)
+		return
+	}
+
+	for _, e := range entries {
+		src := filepath.Join(legacy, e.Name())
+		dst := filepath.Join(dir, e.Name())
+		if _, err := os.Lstat(dst); err == nil {
+			log.Printf("Not migrating %s, %s already exists", src, dst)
+			continue
+		}
+		if err := os.Rename(src, dst); err != nil {
+			log.Printf("Failed to migrate %s: %v", src, err)
+		}
+	}
+	log.Printf("Migrated config from %s to %s", legacy, dir)
+
+	// Remove the fake AppData tree; os.Remove leaves non-empty directories alone
+	roaming := filepath.Dir(legacy)
+	os.Remove(legacy)
+	os.Remove(roaming)
+	os.Remove(filepath.Dir(roaming))
+}
+
+// configDirFromArgs returns the value of --config (or -config) in args, or "".
+// Other arguments are ignored so platform launch flags do not break startup.
+func configDirFromArgs(args []string) string {
+	for i, arg := range args {
+		for _, prefix := range []string{"--config", "-config"} {
+			if arg == prefix && i+1 < len(args) {
+				return args[i+1]
+			}
+			if v, ok := strings.CutPrefix(arg, prefix+"="); ok {
+				return v
+			}
+		}
+	}
+	return ""
 }
 
 // getConfigPath returns the full config file path
@@ -41,15 +153,12 @@ func LoadConfig() *Config {
 	data, err := os.ReadFile(getConfigPath())
 	if err != nil {
 		log.Printf("No config file found, using defaults: %v", err)
-		// Default save directory: user's Downloads folder
-		home, _ := os.UserHomeDir()
-		cfg.SaveDir = filepath.Join(home, "Downloads", "FileBridge")
-		cfg.Lang = "ja"
-		return cfg
+	} else if err := json.Unmarshal(data, cfg); err != nil {
+		log.Printf("Failed to parse config: %v", err)
 	}
 
-	if err := json.Unmarshal(data, cfg); err != nil {
-		log.Printf("Failed to parse config: %v", err)
+	// Default save directory: user's Downloads folder
+	if cfg.SaveDir == "" {
 		home, _ := os.UserHomeDir()
 		cfg.SaveDir = filepath.Join(home, "Downloads", "FileBridge")
 	}
@@ -63,6 +172,68 @@ func LoadConfig() *Config {
 		cfg.ImageQuality = 80
 	}
 
+	// Default HEIC handling
+	if cfg.HEICOutput != heicOutputKeep {
+		cfg.HEICOutput = heicOutputJPEG
+	}
+
+	// Default output format
+	if !validOutputFormats[cfg.OutputFormat] {
+		cfg.OutputFormat = outputFormatKeep
+	}
+
+	// Default duplicate handling: keep both, as before duplicates were detected
+	if cfg.DuplicateMode != duplicateSkip && cfg.DuplicateMode != duplicateLink {
+		cfg.DuplicateMode = duplicateKeep
+	}
+
+	// Default name conflict handling
+	if !validConflictPolicies[cfg.ConflictPolicy] {
+		cfg.ConflictPolicy = conflictRename
+	}
+
+	// Drop a folder template that was edited into something invalid
+	if tmpl, err := parseFolderTemplate(cfg.FolderTemplate); err != nil {
+		cfg.FolderTemplate = ""
+	} else {
+		cfg.FolderTemplate = tmpl
+	}
+
+	// Drop a rename template that was edited into something invalid
+	if tmpl, err := parseRenameTemplate(cfg.RenameTemplate); err != nil {
+		cfg.RenameTemplate = ""
+	} else {
+		cfg.RenameTemplate = tmpl
+	}
+
+	// Drop file type list entries that were edited into something invalid
+	if cfg.AllowTypes, err = parseTypeList(cfg.AllowTypes); err != nil {
+		log.Printf("Ignoring allowed file type: %v", err)
+	}
+	if cfg.DenyTypes, err = parseTypeList(cfg.DenyTypes); err != nil {
+		log.Printf("Ignoring blocked file type: %v", err)
+	}
+
+	// Drop upload rules that were edited into something invalid
+	rules := cfg.Rules[:0]
+	for _, r := range cfg.Rules {
+		valid, err := validateRule(r)
+		if err != nil {
+			log.Printf("Ignoring upload rule %q: %v", r.Name, err)
+			continue
+		}
+		if valid.ID == "" {
+			valid.ID = newRuleID()
+		}
+		rules = append(rules, valid)
+	}
+	cfg.Rules = rules
+
+	// Default shared file lifetime
+	if cfg.ShareExpiryMinutes == 0 {
+		cfg.ShareExpiryMinutes = defaultShareExpiryMinutes
+	}
+
 	return cfg
 }
 
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What to do when a file with the same name is already in the save directory
+const (
+	conflictRename    = "rename"    // save as "name (1).ext"
+	conflictOverwrite = "overwrite" // replace the existing file
+	conflictSkip      = "skip"      // keep the existing file, drop the upload
+	conflictTimestamp = "timestamp" // save as "name_20060102_150405.ext"
+	conflictNewer     = "newer"     // keep whichever file was modified last
+)
+
+// validConflictPolicies lists the accepted conflict policies
+var validConflictPolicies = map[string]bool{
+	conflictRename:    true,
+	conflictOverwrite: true,
+	conflictSkip:      true,
+	conflictTimestamp: true,
+	conflictNewer:     true,
+}
+
+// Actions taken on a name conflict, reported in UploadRecord.ConflictAction
+const (
+	actionRenamed     = "renamed"
+	actionOverwritten = "overwritten"
+	actionSkipped     = "skipped"
+)
+
+// parseConflictPolicy validates a per-request policy. Empty means the configured one.
+func parseConflictPolicy(s string) (string, error) {
+	if s == "" || validConflictPolicies[s] {
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy: %s", s)
+}
+
+// parseModTime parses a JavaScript timestamp (milliseconds since the epoch).
+// Returns the zero time if s is empty or invalid.
+func parseModTime(s string) time.Time {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// conflictPolicy returns the policy that applies to an upload
+func (fs *FileServer) conflictPolicy(meta uploadMeta) string {
+	if meta.Conflict != "" {
+		return meta.Conflict
+	}
+	return fs.app.settings().ConflictPolicy
+}
+
+// resolveDestPath picks where an upload named name is saved in dir. action is
+// "" when there was no conflict, or what was done about it; for actionSkipped
+// the returned path is the existing file, which must be left alone.
+func resolveDestPath(dir, name, policy string, modTime time.Time) (path, action string) {
+	path = filepath.Join(dir, name)
+	existing, err := os.Stat(path)
+	if err != nil {
+		return path, ""
+	}
+
+	switch policy {
+	case conflictOverwrite:
+		return path, actionOverwritten
+	case conflictSkip:
+		return path, actionSkipped
+	case conflictTimestamp:
+		return resolveTimestampPath(dir, name), actionRenamed
+	case conflictNewer:
+		if !modTime.IsZero() {
+			if modTime.After(existing.ModTime()) {
+				return path, actionOverwritten
+			}
+			return path, actionSkipped
+		}
+		// The uploader did not say when the file was modified
+	}
+	return resolveUniquePath(dir, name), actionRenamed
+}
+
+// resolveTimestampPath returns a free path with the current time added to the name
+func resolveTimestampPath(dir, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	return resolveUniquePath(dir, fmt.Sprintf("%s_%s%s", base, time.Now().Format("20060102_150405"), ext))
+}
+
+// recordSkipped adds an upload dropped by the conflict policy to the history
+// and returns its record
+func (fs *FileServer) recordSkipped(existing string, meta uploadMeta) UploadRecord {
+	record := UploadRecord{
+		FileName:       filepath.Base(existing),
+		Timestamp:      time.Now().Format("2006-01-02 15:04:05"),
+		SavePath:       existing,
+		Device:         meta.Device,
+		SHA256:         meta.SHA256,
+		ConflictAction: actionSkipped,
+		Folder:         meta.Folder,
+		Rule:           meta.Rule,
+		ContentType:    meta.ContentType,
+		ExtMismatch:    meta.ExtMismatch,
+	}
+	fs.app.addUploadRecord(record)
+	return record
+}
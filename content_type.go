@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is how many leading bytes are used to detect the content type
+const sniffLen = 512
+
+// Outcomes when the extension of an upload does not match its content,
+// reported in UploadRecord.ExtMismatch
+const (
+	extFixed   = "fixed"   // the extension was changed to match the content
+	extFlagged = "flagged" // the content is unknown or a program; saved as sent
+)
+
+// contentTypesByExt maps the extensions whose content can be recognized to
+// their MIME type. Used to tell whether an extension lies about the content.
+var contentTypesByExt = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".bmp":  "image/bmp",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".avif": "image/avif",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".wav":  "audio/wav",
+	".pdf":  "application/pdf",
+	".zip":  "application/zip",
+	".gz":   "application/x-gzip",
+	".exe":  "application/x-msdownload",
+	".dll":  "application/x-msdownload",
+}
+
+// extensionsByContentType is the extension a file of each type is saved with
+// when its own extension is wrong. Executables and scripts are deliberately
+// missing: a disguised program is flagged, never made runnable again.
+var extensionsByContentType = map[string]string{
+	"image/jpeg":         ".jpg",
+	"image/png":          ".png",
+	"image/gif":          ".gif",
+	"image/webp":         ".webp",
+	"image/bmp":          ".bmp",
+	"image/heic":         ".heic",
+	"image/heif":         ".heif",
+	"image/avif":         ".avif",
+	"image/tiff":         ".tif",
+	"video/mp4":          ".mp4",
+	"video/quicktime":    ".mov",
+	"video/webm":         ".webm",
+	"audio/mpeg":         ".mp3",
+	"audio/mp4":          ".m4a",
+	"audio/wav":          ".wav",
+	"application/pdf":    ".pdf",
+	"application/zip":    ".zip",
+	"application/x-gzip": ".gz",
+}
+
+// scriptTypesByExt gives scripts, which sniff as plain text, a type of
+// their own so they can be blocked
+var scriptTypesByExt = map[string]string{
+	".sh":   "application/x-sh",
+	".bash": "application/x-sh",
+	".bat":  "application/x-bat",
+	".cmd":  "application/x-bat",
+	".ps1":  "application/x-powershell",
+	".vbs":  "text/vbscript",
+	".js":   "text/javascript",
+	".py":   "text/x-python",
+}
+
+// contentFamilies are names usable in type lists for groups of types that
+// do not share a MIME prefix
+var contentFamilies = map[string][]string{
+	"executable": {
+		"application/x-msdownload",
+		"application/x-executable",
+		"application/x-mach-binary",
+		"application/vnd.android.package-archive",
+		"application/java-archive",
+		"application/x-msi",
+	},
+	"script": {
+		"application/x-sh",
+		"application/x-bat",
+		"application/x-powershell",
+		"text/vbscript",
+		"text/javascript",
+		"text/x-python",
+	},
+}
+
+// ftypBrands maps ISO base media brands to content types. The brand at
+// offset 8 of the "ftyp" box tells HEIC, AVIF, MP4 and QuickTime apart.
+var ftypBrands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif",
+	"avif": "image/avif",
+	"avis": "image/avif",
+	"qt  ": "video/quicktime",
+	"M4A ": "audio/mp4",
+	"M4V ": "video/mp4",
+	"isom": "video/mp4",
+	"iso2": "video/mp4",
+	"iso4": "video/mp4",
+	"iso5": "video/mp4",
+	"iso6": "video/mp4",
+	"avc1": "video/mp4",
+	"dash": "video/mp4",
+	"mp41": "video/mp4",
+	"mp42": "video/mp4",
+	"mp71": "video/mp4",
+	"f4v ": "video/mp4",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+}
+
+// sniffContentType detects the type of content from its first bytes. It
+// knows the formats phones send that http.DetectContentType does not, and
+// executables.
+func sniffContentType(head []byte) string {
+	switch {
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		if t, ok := ftypBrands[string(head[8:12])]; ok {
+			return t
+		}
+	case bytes.HasPrefix(head, []byte("MZ")):
+		return "application/x-msdownload"
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		return "application/x-executable"
+	case bytes.HasPrefix(head, []byte("\xcf\xfa\xed\xfe")), bytes.HasPrefix(head, []byte("\xce\xfa\xed\xfe")),
+		bytes.HasPrefix(head, []byte("\xca\xfe\xba\xbe")):
+		return "application/x-mach-binary"
+	case bytes.HasPrefix(head, []byte("#!")):
+		return "application/x-sh"
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return "image/tiff"
+	}
+	return baseMIMEType(http.DetectContentType(head))
+}
+
+// detectContentType returns the content type of the file at path named name
+func detectContentType(path, name string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, sniffLen)
+	n, _ := io.ReadFull(f, head)
+	return detectHeadType(head[:n], name)
+}
+
+// detectHeadType returns the content type of a file named name that starts
+// with head. Archives and text are refined by the extension, since APKs, JARs
+// and scripts cannot be told apart from ZIP files and text by their first bytes.
+func detectHeadType(head []byte, name string) string {
+	t := sniffContentType(head)
+	ext := strings.ToLower(filepath.Ext(name))
+	switch {
+	case t == "application/zip" && ext == ".apk":
+		return "application/vnd.android.package-archive"
+	case t == "application/zip" && ext == ".jar":
+		return "application/java-archive"
+	case ext == ".msi" && bytes.HasPrefix(head, []byte("\xd0\xcf\x11\xe0")):
+		return "application/x-msi"
+	case t == "text/plain" || t == "application/octet-stream":
+		if script, ok := scriptTypesByExt[ext]; ok {
+			return script
+		}
+	}
+	return t
+}
+
+// containerGroups are types that share a container format and whose files
+// are commonly named after one another
+var containerGroups = map[string]string{
+	"image/heic":      "heif",
+	"image/heif":      "heif",
+	"video/mp4":       "isobmff",
+	"audio/mp4":       "isobmff",
+	"video/3gpp":      "isobmff",
+	"video/quicktime": "isobmff",
+}
+
+// sameContainer reports whether a file of type b may carry the extension of type a
+func sameContainer(a, b string) bool {
+	if a == b {
+		return true
+	}
+	group, ok := containerGroups[a]
+	return ok && containerGroups[b] == group
+}
+
+// fixExtension checks the extension of name against the content type. When
+// both are known and differ, the extension is replaced; when the extension
+// claims a known type but the content is not recognized, or is a program,
+// the file is flagged and keeps the name it was sent with.
+func fixExtension(name, contentType string) (string, string) {
+	ext := filepath.Ext(name)
+	claimed, known := contentTypesByExt[strings.ToLower(ext)]
+	if !known {
+		return name, ""
+	}
+	if sameContainer(claimed, contentType) {
+		return name, ""
+	}
+	if matchMIMEType([]string{"executable", "script"}, contentType) {
+		return name, extFlagged
+	}
+	if correct, ok := extensionsByContentType[contentType]; ok {
+		return strings.TrimSuffix(name, ext) + correct, extFixed
+	}
+	return name, extFlagged
+}
+
+// matchMIMEType reports whether mimeType matches one of patterns, which are
+// exact types, families such as "video/*", or the names in contentFamilies
+func matchMIMEType(patterns []string, mimeType string) bool {
+	if mimeType == "" {
+		return false
+	}
+	for _, p := range patterns {
+		if family, ok := contentFamilies[p]; ok {
+			if containsString(family, mimeType) {
+				return true
+			}
+			continue
+		}
+		if p == mimeType || (strings.HasSuffix(p, "/*") && strings.HasPrefix(mimeType, p[:len(p)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTypeList normalizes an allow or deny list of MIME types and families.
+// Invalid entries are left out of the result and reported in the error.
+func parseTypeList(list []string) ([]string, error) {
+	result := []string{}
+	var err error
+	for _, p := range list {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if _, ok := contentFamilies[p]; !ok && !strings.Contains(p, "/") {
+			err = fmt.Errorf("not a MIME type or family: %s", p)
+			continue
+		}
+		result = append(result, p)
+	}
+	return result, err
+}
+
+// RejectedUpload is a file refused by the allow and deny lists
+type RejectedUpload struct {
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType"`
+	Reason      string `json:"reason"`
+}
+
+// rejectedError is returned by storeUpload for a refused file
+type rejectedError struct {
+	RejectedUpload
+}
+
+func (e *rejectedError) Error() string {
+	return e.Reason
+}
+
+// asRejected returns the rejection behind err, if it is one
+func asRejected(err error) (RejectedUpload, bool) {
+	var rejected *rejectedError
+	if errors.As(err, &rejected) {
+		return rejected.RejectedUpload, true
+	}
+	return RejectedUpload{}, false
+}
+
+// checkContentType sniffs a received file, fixes its extension when it does
+// not match the content, and applies the allow and deny lists
+func (fs *FileServer) checkContentType(meta uploadMeta, tmpPath string) (uploadMeta, error) {
+	meta.ContentType = detectContentType(tmpPath, meta.Name)
+	sent := meta.Name
+
+	name, mismatch := fixExtension(meta.Name, meta.ContentType)
+	switch mismatch {
+	case extFixed:
+		log.Printf("%s is %s; saving as %s", meta.Name, meta.ContentType, name)
+	case extFlagged:
+		log.Printf("%s does not look like its extension (%s)", meta.Name, meta.ContentType)
+	}
+	meta.Name = name
+	meta.ExtMismatch = mismatch
+
+	if err := fs.checkTypeLists(sent, meta.ContentType); err != nil {
+		return meta, err
+	}
+	return meta, nil
+}
+
+// checkTypeLists applies the allow and deny lists to a file of contentType
+// sent as name. Refused files return a *rejectedError.
+func (fs *FileServer) checkTypeLists(name, contentType string) error {
+	cfg := fs.app.settings()
+	if matchMIMEType(cfg.DenyTypes, contentType) ||
+		(len(cfg.AllowTypes) > 0 && !matchMIMEType(cfg.AllowTypes, contentType)) {
+		reason := fmt.Sprintf("%s files are not accepted", contentType)
+		return &rejectedError{RejectedUpload{FileName: name, ContentType: contentType, Reason: reason}}
+	}
+	return nil
+}
+
+// checkUploadHead applies the allow and deny lists to the first bytes of a
+// resumable upload, so refused files are turned away before the rest is sent
+func (fs *FileServer) checkUploadHead(name string, head []byte) error {
+	return fs.checkTypeLists(name, detectHeadType(head, name))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// ftypHead returns the start of an ISO base media file with the given brand
+func ftypHead(brand string) []byte {
+	return append([]byte("\x00\x00\x00\x18ftyp"), brand+"\x00\x00\x00\x00mif1"...)
+}
+
+func TestSniffContentType(t *testing.T) {
+	var jpg, pngData bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	if err := jpeg.Encode(&jpg, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"jpeg", jpg.Bytes(), "image/jpeg"},
+		{"png", pngData.Bytes(), "image/png"},
+		{"heic", ftypHead("heic"), "image/heic"},
+		{"heif", ftypHead("mif1"), "image/heif"},
+		{"avif", ftypHead("avif"), "image/avif"},
+		{"quicktime", ftypHead("qt  "), "video/quicktime"},
+		{"mp4 isom", ftypHead("isom"), "video/mp4"},
+		{"mp4 iso5", ftypHead("iso5"), "video/mp4"},
+		{"mp4 dash", ftypHead("dash"), "video/mp4"},
+		{"f4v", ftypHead("f4v "), "video/mp4"},
+		{"windows program", []byte("MZ\x90\x00\x03\x00\x00\x00"), "application/x-msdownload"},
+		{"linux program", []byte("\x7fELF\x02\x01\x01\x00"), "application/x-executable"},
+		{"mac program", []byte("\xcf\xfa\xed\xfe\x07\x00\x00\x01"), "application/x-mach-binary"},
+		{"shell script", []byte("#!/bin/sh\necho hi\n"), "application/x-sh"},
+		{"tiff", []byte("II*\x00\x08\x00\x00\x00"), "image/tiff"},
+		{"text", []byte("hello"), "text/plain"},
+	}
+	for _, tt := range tests {
+		if got := sniffContentType(tt.head); got != tt.want {
+			t.Errorf("%s: sniffContentType = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectHeadType(t *testing.T) {
+	zip := []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00")
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"app.apk", zip, "application/vnd.android.package-archive"},
+		{"lib.jar", zip, "application/java-archive"},
+		{"photos.zip", zip, "application/zip"},
+		{"run.sh", []byte("echo hi\n"), "application/x-sh"},
+		{"notes.txt", []byte("echo hi\n"), "text/plain"},
+	}
+	for _, tt := range tests {
+		if got := detectHeadType(tt.head, tt.name); got != tt.want {
+			t.Errorf("detectHeadType(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFixExtension(t *testing.T) {
+	tests := []struct {
+		name, contentType string
+		want, mismatch    string
+	}{
+		{"photo.jpg", "image/jpeg", "photo.jpg", ""},
+		{"photo.JPG", "image/jpeg", "photo.JPG", ""},
+		{"photo.jpg", "image/png", "photo.png", extFixed},
+		{"photo.heic", "image/jpeg", "photo.jpg", extFixed},
+		{"photo.heic", "image/heif", "photo.heic", ""},
+		{"clip.mov", "video/mp4", "clip.mov", ""},
+		{"clip.mp4", "video/quicktime", "clip.mp4", ""},
+		{"setup.exe", "image/jpeg", "setup.jpg", extFixed},
+
+		// Programs are flagged and keep their name
+		{"photo.jpg", "application/x-msdownload", "photo.jpg", extFlagged},
+		{"photo.jpg", "application/x-executable", "photo.jpg", extFlagged},
+		{"photo.png", "application/x-sh", "photo.png", extFlagged},
+		{"report.pdf", "application/vnd.android.package-archive", "report.pdf", extFlagged},
+
+		// Unknown content is flagged; unknown extensions are left alone
+		{"photo.jpg", "application/octet-stream", "photo.jpg", extFlagged},
+		{"notes.txt", "image/png", "notes.txt", ""},
+		{"README", "image/png", "README", ""},
+	}
+	for _, tt := range tests {
+		got, mismatch := fixExtension(tt.name, tt.contentType)
+		if got != tt.want || mismatch != tt.mismatch {
+			t.Errorf("fixExtension(%q, %q) = %q, %q, want %q, %q", tt.name, tt.contentType, got, mismatch, tt.want, tt.mismatch)
+		}
+	}
+}
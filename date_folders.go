@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// tagDateTimeOriginal is the EXIF DateTimeOriginal tag in the Exif sub-IFD
+const tagDateTimeOriginal = 0x9003
+
+// exifDateLayout is the format of EXIF date fields, in the camera's local time
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// folderTemplateTokens are the placeholders accepted in a folder template
+var folderTemplateTokens = map[string]string{
+	"{yyyy}": "2006",
+	"{yy}":   "06",
+	"{MM}":   "01",
+	"{dd}":   "02",
+}
+
+// folderTemplateToken matches anything that looks like a placeholder
+var folderTemplateToken = regexp.MustCompile(`\{[^{}]*\}`)
+
+// parseFolderTemplate validates a date folder template such as
+// "{yyyy}/{MM}/{dd}". Empty turns date sorting off.
+func parseFolderTemplate(s string) (string, error) {
+	s = strings.Trim(strings.TrimSpace(strings.ReplaceAll(s, "\\", "/")), "/")
+	if s == "" {
+		return "", nil
+	}
+	for _, token := range folderTemplateToken.FindAllString(s, -1) {
+		if _, ok := folderTemplateTokens[token]; !ok {
+			return "", fmt.Errorf("unknown placeholder in folder template: %s", token)
+		}
+	}
+	if _, _, err := sanitizeRelativePath(expandFolderTemplate(s, time.Now()) + "/x"); err != nil {
+		return "", fmt.Errorf("invalid folder template %q", s)
+	}
+	return s, nil
+}
+
+// expandFolderTemplate fills in the placeholders of a template with t
+func expandFolderTemplate(tmpl string, t time.Time) string {
+	return folderTemplateToken.ReplaceAllStringFunc(tmpl, func(token string) string {
+		if layout, ok := folderTemplateTokens[token]; ok {
+			return t.Format(layout)
+		}
+		return token
+	})
+}
+
+// exifDateTimeOriginal returns when a photo was taken according to its EXIF
+// data, or the zero time if it is not recorded
+func exifDateTimeOriginal(tiff []byte) time.Time {
+	order := tiffByteOrder(tiff)
+	if order == nil {
+		return time.Time{}
+	}
+	exifIFD := ifd0Entry(tiff, order, tagExifIFD)
+	if exifIFD < 0 {
+		return time.Time{}
+	}
+	entry := ifdEntry(tiff, order, int(order.Uint32(tiff[exifIFD+8:])), tagDateTimeOriginal)
+	if entry < 0 || order.Uint16(tiff[entry+2:]) != 2 {
+		return time.Time{}
+	}
+
+	// ASCII "YYYY:MM:DD HH:MM:SS\0", always stored outside the entry
+	off := int(order.Uint32(tiff[entry+8:]))
+	n := len(exifDateLayout)
+	if off < 8 || off+n > len(tiff) {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(exifDateLayout, string(tiff[off:off+n]), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// captureTime returns the EXIF DateTimeOriginal of a JPEG or HEIC file, or
+// the zero time. Only the metadata is read, not the image data.
+func captureTime(path, ext string) time.Time {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+
+	var tiff []byte
+	switch ext {
+	case ".jpg", ".jpeg":
+		tiff = readJPEGExif(f)
+	case ".heic", ".heif":
+		if st, err := f.Stat(); err == nil {
+			tiff = readHEIFExif(f, st.Size())
+		}
+	}
+	return exifDateTimeOriginal(tiff)
+}
+
+// uploadDate returns the date of an upload: the EXIF DateTimeOriginal, then
+// the phone's modification time, then now
+func uploadDate(meta uploadMeta, tmpPath string) time.Time {
+	if date := captureTime(tmpPath, strings.ToLower(filepath.Ext(meta.Name))); !date.IsZero() {
+		return date
+	}
+	if !meta.ModTime.IsZero() {
+		return meta.ModTime
+	}
+	return time.Now()
+}
+
+// routeByDate sets the folder of an upload from the folder template, dated by
+// meta.Date (see uploadDate). Folder uploads keep the structure they were sent with.
+func (fs *FileServer) routeByDate(meta uploadMeta) uploadMeta {
+	tmpl := fs.app.settings().FolderTemplate
+	if tmpl == "" || meta.Folder != "" {
+		return meta
+	}
+	folder, _, err := sanitizeRelativePath(expandFolderTemplate(tmpl, meta.Date) + "/" + meta.Name)
+	if err == nil {
+		meta.Folder = folder
+	}
+	return meta
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// deviceCookieName is the long-lived cookie that identifies a device across sessions
+const deviceCookieName = "fb_device"
+
+// approvalTimeout is how long an upload waits for the user to answer the prompt
+const approvalTimeout = 60 * time.Second
+
+// ApprovedDevice is a device the user has accepted files from
+type ApprovedDevice struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	ApprovedAt string `json:"approvedAt"`
+}
+
+// ApprovalRequest is sent to the frontend when an unknown device wants to upload
+type ApprovalRequest struct {
+	ID       string `json:"id"`
+	DeviceID string `json:"deviceId"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+}
+
+// pendingApproval is a prompt waiting for an answer. All uploads from the
+// same device wait on the same prompt.
+type pendingApproval struct {
+	request  ApprovalRequest
+	done     chan struct{}
+	approved bool
+	timedOut bool
+	once     sync.Once
+	timer    *time.Timer
+}
+
+// resolve records the answer and wakes every waiting upload
+func (p *pendingApproval) resolve(approved, timedOut bool) {
+	p.once.Do(func() {
+		p.approved = approved
+		p.timedOut = timedOut
+		close(p.done)
+	})
+}
+
+// deviceApprovals tracks prompts that are currently shown on the desktop
+type deviceApprovals struct {
+	mu      sync.Mutex
+	pending map[string]*pendingApproval // keyed by device ID
+}
+
+// newDeviceApprovals creates an empty approval tracker
+func newDeviceApprovals() *deviceApprovals {
+	return &deviceApprovals{pending: make(map[string]*pendingApproval)}
+}
+
+// deviceNameFromUA returns a readable device name from a User-Agent string
+func deviceNameFromUA(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPhone"):
+		return "iPhone"
+	case strings.Contains(ua, "iPad"):
+		return "iPad"
+	case strings.Contains(ua, "Android"):
+		return "Android"
+	case strings.Contains(ua, "Windows"):
+		return "Windows PC"
+	case strings.Contains(ua, "Macintosh"):
+		return "Mac"
+	case strings.Contains(ua, "Linux"):
+		return "Linux PC"
+	}
+	return "Unknown device"
+}
+
+// deviceLabel returns a display name for the requesting device, e.g. "iPhone (192.168.1.23)"
+func deviceLabel(r *http.Request) string {
+	return fmt.Sprintf("%s (%s)", deviceNameFromUA(r.UserAgent()), remoteHost(r))
+}
+
+// requestDeviceID returns the device ID from the device cookie, or "" if the
+// request has none
+func requestDeviceID(r *http.Request) string {
+	if c, err := r.Cookie(deviceCookieName); err == nil && len(c.Value) == 32 {
+		if _, err := hex.DecodeString(c.Value); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// deviceID returns the device ID from the request, assigning a new one via
+// cookie if the device does not have one yet
+func deviceID(w http.ResponseWriter, r *http.Request) string {
+	if id := requestDeviceID(r); id != "" {
+		return id
+	}
+
+	id := hex.EncodeToString(randomBytes(16))
+	http.SetCookie(w, &http.Cookie{
+		Name:     deviceCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return id
+}
+
+// approvalDeviceID returns the ID a device is approved under. Browsers get the
+// device cookie with the upload page; clients that never keep it, such as
+// scripts sending the session token, are known by their session instead.
+func (fs *FileServer) approvalDeviceID(w http.ResponseWriter, r *http.Request) string {
+	if id := requestDeviceID(r); id != "" {
+		return id
+	}
+	if id, ok := fs.auth.validate(requestToken(r)); ok {
+		return id
+	}
+	return deviceID(w, r)
+}
+
+// requireApproval wraps an API handler so uploads from devices the user has
+// not approved yet are held until the desktop prompt is answered
+func (fs *FileServer) requireApproval(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := fs.approvalDeviceID(w, r)
+		if fs.app.isDeviceApproved(id) {
+			next(w, r)
+			return
+		}
+
+		name := deviceLabel(r)
+		p := fs.app.requestDeviceApproval(id, name, remoteHost(r))
+
+		select {
+		case <-p.done:
+		case <-r.Context().Done():
+			return
+		}
+
+		if p.timedOut {
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"error": "No response from the PC. Please accept the device in File Bridge and try again.",
+				"code":  "approval_timeout",
+			})
+			return
+		}
+		if !p.approved {
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"error": "The PC declined files from this device.",
+				"code":  "approval_denied",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isDeviceApproved reports whether a device is in the approved list
+func (a *App) isDeviceApproved(id string) bool {
+	for _, d := range a.settings().ApprovedDevices {
+		if d.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// requestDeviceApproval asks the frontend whether to accept files from a device.
+// Returns the pending prompt to wait on; concurrent calls for the same device share it.
+func (a *App) requestDeviceApproval(id, name, address string) *pendingApproval {
+	a.approvals.mu.Lock()
+	defer a.approvals.mu.Unlock()
+
+	if p, ok := a.approvals.pending[id]; ok {
+		return p
+	}
+
+	p := &pendingApproval{
+		request: ApprovalRequest{
+			ID:       hex.EncodeToString(randomBytes(8)),
+			DeviceID: id,
+			Name:     name,
+			Address:  address,
+		},
+		done: make(chan struct{}),
+	}
+	a.approvals.pending[id] = p
+
+	if a.headless {
+		// Nobody to ask; pairing with the PIN or QR code is the only gate
+		delete(a.approvals.pending, id)
+		a.rememberDevice(id, name)
+		log.Printf("Device approved (headless): %s", name)
+		p.resolve(true, false)
+		return p
+	}
+	if a.ctx == nil {
+		// No desktop UI to ask
+		log.Printf("Cannot prompt for device approval of %s, declining", name)
+		delete(a.approvals.pending, id)
+		p.resolve(false, false)
+		return p
+	}
+
+	log.Printf("Waiting for approval of device %s", name)
+	runtime.EventsEmit(a.ctx, "device:approval", p.request)
+
+	p.timer = time.AfterFunc(approvalTimeout, func() {
+		a.approvals.mu.Lock()
+		if a.approvals.pending[id] == p {
+			delete(a.approvals.pending, id)
+		}
+		a.approvals.mu.Unlock()
+		p.resolve(false, true)
+		if a.ctx != nil {
+			runtime.EventsEmit(a.ctx, "device:approval-resolved", p.request.ID)
+		}
+	})
+	return p
+}
+
+// RespondDeviceApproval answers a device approval prompt. Accepted devices are
+// remembered in the config.
+func (a *App) RespondDeviceApproval(requestID string, accept bool) error {
+	a.approvals.mu.Lock()
+	var p *pendingApproval
+	for id, candidate := range a.approvals.pending {
+		if candidate.request.ID == requestID {
+			p = candidate
+			delete(a.approvals.pending, id)
+			break
+		}
+	}
+	a.approvals.mu.Unlock()
+
+	if p == nil {
+		return fmt.Errorf("approval request not found or expired: %s", requestID)
+	}
+
+	if accept {
+		a.rememberDevice(p.request.DeviceID, p.request.Name)
+		log.Printf("Device approved: %s", p.request.Name)
+	} else {
+		log.Printf("Device declined: %s", p.request.Name)
+	}
+
+	p.timer.Stop()
+	p.resolve(accept, false)
+	runtime.EventsEmit(a.ctx, "device:approval-resolved", requestID)
+	return nil
+}
+
+// rememberDevice adds a device to the approved list and saves the config
+func (a *App) rememberDevice(id, name string) {
+	err := a.updateConfig(func(cfg *Config) error {
+		// A new slice, so snapshots from settings() never see the addition
+		cfg.ApprovedDevices = append(append([]ApprovedDevice{}, cfg.ApprovedDevices...), ApprovedDevice{
+			ID:         id,
+			Name:       name,
+			ApprovedAt: time.Now().Format("2006-01-02 15:04:05"),
+		})
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to save config: %v", err)
+	}
+}
+
+// GetApprovedDevices returns the devices files are accepted from without asking
+func (a *App) GetApprovedDevices() []ApprovedDevice {
+	devices := a.settings().ApprovedDevices
+	result := make([]ApprovedDevice, len(devices))
+	copy(result, devices)
+	return result
+}
+
+// ForgetDevice removes a device from the approved list so it is asked again
+func (a *App) ForgetDevice(id string) error {
+	return a.updateConfig(func(cfg *Config) error {
+		devices := make([]ApprovedDevice, 0, len(cfg.ApprovedDevices))
+		for _, d := range cfg.ApprovedDevices {
+			if d.ID != id {
+				devices = append(devices, d)
+			}
+		}
+		if len(devices) == len(cfg.ApprovedDevices) {
+			return fmt.Errorf("device not found: %s", id)
+		}
+		cfg.ApprovedDevices = devices
+		return nil
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// useTestConfigDir makes saved configs go to a temp directory for the test
+func useTestConfigDir(t *testing.T) {
+	t.Helper()
+	old := configDirOverride
+	configDirOverride = t.TempDir()
+	t.Cleanup(func() { configDirOverride = old })
+}
+
+func TestRememberDeviceKeepsSnapshots(t *testing.T) {
+	useTestConfigDir(t)
+	fs, _ := newTestFileServer(t, Config{ApprovedDevices: make([]ApprovedDevice, 1, 4)})
+	snapshot := fs.app.settings().ApprovedDevices
+
+	fs.app.rememberDevice("0123456789abcdef0123456789abcdef", "iPhone (192.168.1.5)")
+	if spare := snapshot[:cap(snapshot)]; spare[1].ID != "" {
+		t.Error("an earlier snapshot of the approved devices was changed")
+	}
+	if got := fs.app.GetApprovedDevices(); len(got) != 2 {
+		t.Errorf("approved devices = %+v, want 2", got)
+	}
+}
+
+func TestApprovalWithoutDeviceCookie(t *testing.T) {
+	useTestConfigDir(t)
+	fs, _ := newTestFileServer(t, Config{})
+	fs.auth.mu.Lock()
+	token := fs.auth.issueLocked(httptest.NewRequest(http.MethodPost, "/api/pair", nil))
+	fs.auth.mu.Unlock()
+	sessionID, _ := fs.auth.validate(token)
+
+	// A script sending only the session token; headless mode approves it
+	calls := 0
+	handler := fs.requireApproval(func(http.ResponseWriter, *http.Request) { calls++ })
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/upload", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		handler(httptest.NewRecorder(), req)
+	}
+	if calls != 3 {
+		t.Fatalf("handler ran %d times, want 3", calls)
+	}
+	devices := fs.app.GetApprovedDevices()
+	if len(devices) != 1 || devices[0].ID != sessionID {
+		t.Errorf("approved devices = %+v, want only session %s", devices, sessionID)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How files that are already in the save directory are handled
+const (
+	duplicateKeep = "keep" // save another copy as "name (1).ext"
+	duplicateSkip = "skip" // do not save the file again
+	duplicateLink = "link" // hard-link the new name to the existing file
+)
+
+// duplicateRescanInterval is how long the file size listing of the save
+// directory is trusted before it is walked again
+const duplicateRescanInterval = 10 * time.Minute
+
+// fileHash is a cached content hash, valid while size and mtime match
+type fileHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// sourceFile is where an upload was saved, with the size and mtime the file
+// had then, so later changes to it are noticed
+type sourceFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// unchanged reports whether the file still has the size and mtime recorded
+func (s sourceFile) unchanged() bool {
+	st, err := os.Stat(s.path)
+	return err == nil && st.Mode().IsRegular() && st.Size() == s.size && st.ModTime().Equal(s.modTime)
+}
+
+// duplicateIndex finds files in save directories by SHA-256. Each directory
+// has an index of its own, built lazily: the directory is listed by size, and
+// only files whose size matches an upload are hashed. Uploads are also indexed
+// by the hash of the bytes received, so compressed copies are found too.
+type duplicateIndex struct {
+	mu      sync.Mutex // guards dirs
+	dirs    map[string]*dirIndex
+	history func() []UploadRecord
+}
+
+// dirIndex is the duplicate index of one directory
+type dirIndex struct {
+	mu      sync.Mutex
+	built   bool
+	scanned time.Time
+	sizes   map[int64][]string    // size → paths, from the last walk
+	hashes  map[string]fileHash   // path → content hash
+	sources map[string]sourceFile // received hash → saved file
+}
+
+// newDuplicateIndex creates an empty index. history supplies past uploads
+// with their received hashes.
+func newDuplicateIndex(history func() []UploadRecord) *duplicateIndex {
+	return &duplicateIndex{
+		dirs:    make(map[string]*dirIndex),
+		history: history,
+	}
+}
+
+// index returns the index of dir, creating an empty one if needed
+func (d *duplicateIndex) index(dir string) *dirIndex {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	idx, ok := d.dirs[dir]
+	if !ok {
+		idx = &dirIndex{hashes: make(map[string]fileHash)}
+		d.dirs[dir] = idx
+	}
+	return idx
+}
+
+// Lookup returns the path of a file in dir with the given content or source
+// hash, or "" if there is none
+func (d *duplicateIndex) Lookup(dir, sum string, size int64) string {
+	if sum == "" {
+		return ""
+	}
+	idx := d.index(dir)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.prepare(dir, d.history)
+	if src, ok := idx.sources[sum]; ok {
+		if src.unchanged() {
+			return src.path
+		}
+		// Overwritten or edited since it was saved
+		delete(idx.sources, sum)
+	}
+	for _, path := range idx.sizes[size] {
+		if idx.hashOf(path) == sum {
+			return path
+		}
+	}
+	return ""
+}
+
+// Add records an upload saved to path in dir. received is the hash of the
+// bytes sent by the phone; rewritten is true when the saved file differs from them.
+func (d *duplicateIndex) Add(dir, path, received string, rewritten bool) {
+	idx := d.index(dir)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// Nothing to update until the index for dir has been built
+	if !idx.built || received == "" {
+		return
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	idx.sources[received] = sourceFile{path: path, size: st.Size(), modTime: st.ModTime()}
+	idx.sizes[st.Size()] = append(idx.sizes[st.Size()], path)
+	if !rewritten {
+		idx.hashes[path] = fileHash{size: st.Size(), modTime: st.ModTime(), sum: received}
+	}
+}
+
+// Forget drops what is known about the file at path, which is about to be
+// replaced
+func (d *duplicateIndex) Forget(path string) {
+	d.mu.Lock()
+	dirs := make([]*dirIndex, 0, len(d.dirs))
+	for _, idx := range d.dirs {
+		dirs = append(dirs, idx)
+	}
+	d.mu.Unlock()
+
+	for _, idx := range dirs {
+		idx.mu.Lock()
+		delete(idx.hashes, path)
+		for sum, src := range idx.sources {
+			if src.path == path {
+				delete(idx.sources, sum)
+			}
+		}
+		idx.mu.Unlock()
+	}
+}
+
+// prepare builds the index for dir, and walks it again when the listing is stale
+func (idx *dirIndex) prepare(dir string, history func() []UploadRecord) {
+	if !idx.built {
+		idx.sources = sourcesFromHistory(dir, history())
+		idx.built = true
+	}
+	if time.Since(idx.scanned) < duplicateRescanInterval {
+		return
+	}
+
+	idx.sizes = make(map[int64][]string)
+	filepath.WalkDir(dir, func(path string, e os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if e.IsDir() {
+			if e.Name() == stagingDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := e.Info(); err == nil && info.Mode().IsRegular() {
+			idx.sizes[info.Size()] = append(idx.sizes[info.Size()], path)
+		}
+		return nil
+	})
+	idx.scanned = time.Now()
+}
+
+// sourcesFromHistory indexes the saved uploads in dir by received hash.
+// records are oldest first; a path only keeps the upload saved to it last,
+// and only while the file still has the recorded size.
+func sourcesFromHistory(dir string, records []UploadRecord) map[string]sourceFile {
+	latest := make(map[string]UploadRecord) // path → last upload saved there
+	for _, r := range records {
+		// Skipped and queued uploads were not saved under SavePath
+		if r.SavePath == "" || r.Status != "" || r.ConflictAction == actionSkipped || !withinDir(r.SavePath, dir) {
+			continue
+		}
+		latest[r.SavePath] = r
+	}
+
+	sources := make(map[string]sourceFile)
+	for path, r := range latest {
+		if r.SHA256 == "" {
+			continue
+		}
+		st, err := os.Stat(path)
+		if err != nil || st.Size() != r.Size {
+			continue
+		}
+		sources[r.SHA256] = sourceFile{path: path, size: st.Size(), modTime: st.ModTime()}
+	}
+	return sources
+}
+
+// withinDir reports whether path is inside dir
+func withinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// hashOf returns the SHA-256 of a file, from the cache when it is unchanged
+func (idx *dirIndex) hashOf(path string) string {
+	st, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	if c, ok := idx.hashes[path]; ok && c.size == st.Size() && c.modTime.Equal(st.ModTime()) {
+		return c.sum
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		log.Printf("Failed to hash %s: %v", path, err)
+		return ""
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	idx.hashes[path] = fileHash{size: st.Size(), modTime: st.ModTime(), sum: sum}
+	return sum
+}
+
+// checkDuplicate applies the duplicate setting to a received file. It returns
+// a record and true when the upload has been handled (skipped or linked).
+func (fs *FileServer) checkDuplicate(saveDir string, meta uploadMeta, tmpPath string) (UploadRecord, bool) {
+	mode := fs.app.settings().DuplicateMode
+	if mode == duplicateKeep || meta.SHA256 == "" {
+		return UploadRecord{}, false
+	}
+	st, err := os.Stat(tmpPath)
+	if err != nil {
+		return UploadRecord{}, false
+	}
+	existing := fs.dupes.Lookup(saveDir, meta.SHA256, st.Size())
+	if existing == "" {
+		return UploadRecord{}, false
+	}
+
+	if mode == duplicateSkip {
+		os.Remove(tmpPath)
+		log.Printf("Skipped %s: same content as %s", meta.Name, existing)
+		record := UploadRecord{
+			FileName:    meta.Name,
+			Size:        st.Size(),
+			Timestamp:   time.Now().Format("2006-01-02 15:04:05"),
+			SavePath:    existing,
+			Device:      meta.Device,
+			Status:      uploadDuplicate,
+			SHA256:      meta.SHA256,
+			DuplicateOf: existing,
+			Folder:      meta.Folder,
+			Rule:        meta.Rule,
+			ContentType: meta.ContentType,
+			ExtMismatch: meta.ExtMismatch,
+		}
+		fs.app.addUploadRecord(record)
+		return record, true
+	}
+
+	// Link under the upload's name, with the extension of the saved file
+	// (which may have been converted)
+	name := meta.Name[:len(meta.Name)-len(filepath.Ext(meta.Name))] + filepath.Ext(existing)
+	destPath, action, err := fs.linkUpload(existing, saveDir, name, meta)
+	if err != nil {
+		// e.g. FAT-formatted drives; save a normal copy instead
+		log.Printf("Failed to hard-link %s to %s: %v", name, existing, err)
+		return UploadRecord{}, false
+	}
+	os.Remove(tmpPath)
+	if action == actionSkipped {
+		log.Printf("Skipped %s: %s already exists", meta.Name, destPath)
+		return fs.recordSkipped(destPath, meta), true
+	}
+
+	linked, _ := os.Stat(destPath)
+	record := UploadRecord{
+		FileName:       filepath.Base(destPath),
+		Timestamp:      time.Now().Format("2006-01-02 15:04:05"),
+		SavePath:       destPath,
+		Device:         meta.Device,
+		SHA256:         meta.SHA256,
+		DuplicateOf:    existing,
+		ConflictAction: action,
+		Folder:         meta.Folder,
+		Rule:           meta.Rule,
+		ContentType:    meta.ContentType,
+		ExtMismatch:    meta.ExtMismatch,
+	}
+	if linked != nil {
+		record.Size = linked.Size()
+	}
+	fs.app.addUploadRecord(record)
+
+	log.Printf("File saved (hard link to %s): %s", existing, destPath)
+	return record, true
+}
+
+// linkUpload hard-links name in saveDir to an existing file, applying the
+// conflict policy like placeUpload
+func (fs *FileServer) linkUpload(existing, saveDir, name string, meta uploadMeta) (string, string, error) {
+	fs.placeMu.Lock()
+	defer fs.placeMu.Unlock()
+
+	destDir, err := uploadDir(saveDir, meta)
+	if err != nil {
+		return "", "", err
+	}
+	name = renameUpload(destDir, name, meta, existing)
+	destPath, action := resolveDestPath(destDir, name, fs.conflictPolicy(meta), meta.ModTime)
+	if action == actionSkipped || destPath == existing {
+		return destPath, action, nil
+	}
+	if action == actionOverwritten {
+		// Links cannot replace a file
+		fs.dupes.Forget(destPath)
+		os.Remove(destPath)
+	}
+	if err := os.Link(existing, destPath); err != nil {
+		return "", "", err
+	}
+	return destPath, action, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// storeTestUpload saves data as an upload named name, as if it had just
+// been received
+func storeTestUpload(t *testing.T, fs *FileServer, saveDir, name, conflict string, data []byte) UploadRecord {
+	t.Helper()
+	tmpPath, err := receiveToTemp(saveDir, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	record, err := fs.storeUpload(saveDir, uploadMeta{Name: name, SHA256: hex.EncodeToString(sum[:]), Conflict: conflict}, tmpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+// checkSaved fails the test if the file name in saveDir does not hold data
+func checkSaved(t *testing.T, saveDir, name string, data []byte) {
+	t.Helper()
+	got, err := os.ReadFile(filepath.Join(saveDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("%s holds %q, want %q", name, got, data)
+	}
+}
+
+func TestDuplicateAfterOverwrite(t *testing.T) {
+	original, changed := []byte("original"), []byte("changed!")
+	for _, mode := range []string{duplicateSkip, duplicateLink} {
+		t.Run(mode, func(t *testing.T) {
+			fs, saveDir := newTestFileServer(t, Config{DuplicateMode: mode})
+			storeTestUpload(t, fs, saveDir, "a.txt", "", original)
+			storeTestUpload(t, fs, saveDir, "a.txt", conflictOverwrite, changed)
+			checkSaved(t, saveDir, "a.txt", changed)
+
+			// a.txt no longer holds the original, so it is not a duplicate
+			record := storeTestUpload(t, fs, saveDir, "copy.txt", "", original)
+			if record.Status == uploadDuplicate || record.DuplicateOf != "" {
+				t.Fatalf("original counted as a duplicate of %s", record.DuplicateOf)
+			}
+			checkSaved(t, saveDir, "copy.txt", original)
+			checkSaved(t, saveDir, "a.txt", changed)
+		})
+	}
+}
+
+func TestDuplicateAfterEdit(t *testing.T) {
+	fs, saveDir := newTestFileServer(t, Config{DuplicateMode: duplicateLink})
+	original := []byte("original")
+	storeTestUpload(t, fs, saveDir, "a.txt", "", original)
+
+	// Edited outside the app, keeping the size
+	path := filepath.Join(saveDir, "a.txt")
+	if err := os.WriteFile(path, []byte("edited!!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	record := storeTestUpload(t, fs, saveDir, "copy.txt", "", original)
+	if record.DuplicateOf != "" {
+		t.Fatalf("original linked to edited %s", record.DuplicateOf)
+	}
+	checkSaved(t, saveDir, "copy.txt", original)
+}
+
+func TestDuplicateSkipRecorded(t *testing.T) {
+	fs, saveDir := newTestFileServer(t, Config{DuplicateMode: duplicateSkip})
+	data := []byte("same content")
+	first := storeTestUpload(t, fs, saveDir, "a.txt", "", data)
+
+	record := storeTestUpload(t, fs, saveDir, "b.txt", "", data)
+	if record.Status != uploadDuplicate || record.DuplicateOf != first.SavePath {
+		t.Fatalf("record = %+v, want a duplicate of %s", record, first.SavePath)
+	}
+	if _, err := os.Stat(filepath.Join(saveDir, "b.txt")); !os.IsNotExist(err) {
+		t.Error("duplicate was saved")
+	}
+	if history := fs.app.GetUploadHistory(); len(history) == 0 || history[0].Status != uploadDuplicate {
+		t.Errorf("skipped duplicate missing from history: %+v", history)
+	}
+}
+
+func TestDuplicateIndexPerDirectory(t *testing.T) {
+	d := newDuplicateIndex(func() []UploadRecord { return nil })
+	a, b := t.TempDir(), t.TempDir()
+	data := []byte("photo")
+	if err := os.WriteFile(filepath.Join(a, "x.jpg"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if got := d.Lookup(a, hash, int64(len(data))); got != filepath.Join(a, "x.jpg") {
+		t.Fatalf("Lookup(a) = %q", got)
+	}
+	scanned := d.dirs[a].scanned
+	if got := d.Lookup(b, hash, int64(len(data))); got != "" {
+		t.Fatalf("Lookup(b) = %q, want none", got)
+	}
+	d.Lookup(a, hash, int64(len(data)))
+	if !d.dirs[a].scanned.Equal(scanned) {
+		t.Error("looking in another directory made a walk again")
+	}
+}
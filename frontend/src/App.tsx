@@ -1,8 +1,9 @@
 import { useState, useEffect, useCallback } from 'react';
 import { QRCodeSVG } from 'qrcode.react';
 import './App.css';
-import { GetServerInfo, SelectSaveDir, GetUploadHistory, SetLang, GetCompressSettings, SetCompressSettings } from '../wailsjs/go/main/App';
+import { GetServerInfo, SelectSaveDir, QueryUploadHistory, SetLang, GetCompressSettings, SetCompressSettings, SetHEICSettings, SetOutputFormat, SetPrivacyMode, GetCompressQueue, GetSessions, RevokeSession, RevokeAllSessions, GetApprovedDevices, ForgetDevice, RespondDeviceApproval, SetUseHTTPS, ShareFiles, GetSharedFiles, RemoveSharedFile, GetTextHistory, SendTextToPhone, CopyTextToClipboard, GetAutoCopyText, SetAutoCopyText, GetDuplicateMode, SetDuplicateMode, GetConflictPolicy, SetConflictPolicy, GetFolderTemplate, SetFolderTemplate, GetRenameTemplate, SetRenameTemplate, PreviewRenameTemplate, GetFileTypeLists, SetFileTypeLists, GetUploadRules, SaveUploadRule, DeleteUploadRule, MoveUploadRule, TestUploadRules } from '../wailsjs/go/main/App';
 import { EventsOn } from '../wailsjs/runtime/runtime';
+import { main } from '../wailsjs/go/models';
 import { LanguageContext, getTranslation, type Lang, type TranslationKey } from './i18n';
 
 interface ServerInfo {
@@ -12,6 +13,17 @@ interface ServerInfo {
   lanIP: string;
   saveDir: string;
   lang: string;
+  pin: string;
+  https: boolean;
+  certFingerprint: string;
+}
+
+interface Session {
+  id: string;
+  userAgent: string;
+  address: string;
+  created: string;
+  expires: string;
 }
 
 interface UploadRecord {
@@ -21,12 +33,137 @@ interface UploadRecord {
   savePath: string;
   compressed?: boolean;
   originalSize?: number;
+  device?: string;
+  exists: boolean;
+  metadataStripped?: boolean;
+  sha256?: string;
+  status?: string;
+  duplicateOf?: string;
+  conflictAction?: string;
+  folder?: string;
+  rule?: string;
+  contentType?: string;
+  extMismatch?: string;
+}
+
+interface CompressJob {
+  id: number;
+  fileName: string;
+  device?: string;
+  state: string;
+  pending: number;
+  error?: string;
+}
+
+interface HistoryFilter {
+  search: string;
+  from: string;
+  to: string;
+  compressedOnly: boolean;
+  page: number;
+}
+
+const HISTORY_PAGE_SIZE = 20;
+
+interface ApprovedDevice {
+  id: string;
+  name: string;
+  approvedAt: string;
+}
+
+interface ApprovalRequest {
+  id: string;
+  deviceId: string;
+  name: string;
+  address: string;
+}
+
+interface SharedFile {
+  id: string;
+  name: string;
+  size: number;
+  path: string;
+  addedAt: string;
+  expiresAt: string;
+}
+
+interface TextMessage {
+  id: number;
+  text: string;
+  from: 'phone' | 'pc';
+  device?: string;
+  timestamp: string;
 }
 
 interface CompressSettings {
   compressImages: boolean;
   imageQuality: number;
   keepOriginal: boolean;
+  maxDimension: number;
+  heicOutput: string;
+  convertHEIC: boolean;
+  privacyMode: boolean;
+  outputFormat: string;
+  pngToWebp: boolean;
+}
+
+// RuleDraft is an upload rule being edited, with lists and sizes as typed
+interface RuleDraft {
+  id: string;
+  name: string;
+  enabled: boolean;
+  extensions: string;
+  mimeTypes: string;
+  nameGlob: string;
+  nameRegex: string;
+  minSizeMB: string;
+  maxSizeMB: string;
+  device: string;
+  saveDir: string;
+  compress: string;
+  renameTemplate: string;
+}
+
+const MB = 1024 * 1024;
+
+// RENAME_SAMPLE is the file name the rename template preview is shown for
+const RENAME_SAMPLE = 'IMG_4821.JPG';
+
+function ruleToDraft(r?: main.UploadRule): RuleDraft {
+  return {
+    id: r?.id ?? '',
+    name: r?.name ?? '',
+    enabled: r?.enabled ?? true,
+    extensions: (r?.extensions ?? []).join(', '),
+    mimeTypes: (r?.mimeTypes ?? []).join(', '),
+    nameGlob: r?.nameGlob ?? '',
+    nameRegex: r?.nameRegex ?? '',
+    minSizeMB: r?.minSize ? String(r.minSize / MB) : '',
+    maxSizeMB: r?.maxSize ? String(r.maxSize / MB) : '',
+    device: r?.device ?? '',
+    saveDir: r?.saveDir ?? '',
+    compress: r?.compress ?? '',
+    renameTemplate: r?.renameTemplate ?? '',
+  };
+}
+
+function draftToRule(d: RuleDraft): main.UploadRule {
+  const list = (s: string) => s.split(',').map(v => v.trim()).filter(v => v !== '');
+  return main.UploadRule.createFrom({
+    id: d.id,
+    name: d.name,
+    enabled: d.enabled,
+    extensions: list(d.extensions),
+    mimeTypes: list(d.mimeTypes),
+    nameGlob: d.nameGlob,
+    nameRegex: d.nameRegex,
+    minSize: Math.round((Number(d.minSizeMB) || 0) * MB),
+    maxSize: Math.round((Number(d.maxSizeMB) || 0) * MB),
+    device: d.device,
+    saveDir: d.saveDir,
+    compress: d.compress,
+    renameTemplate: d.renameTemplate,
+  });
 }
 
 function formatSize(bytes: number): string {
@@ -39,11 +176,44 @@ function formatSize(bytes: number): string {
 function App() {
   const [serverInfo, setServerInfo] = useState<ServerInfo | null>(null);
   const [history, setHistory] = useState<UploadRecord[]>([]);
+  const [historyTotal, setHistoryTotal] = useState(0);
+  const [historyFilter, setHistoryFilter] = useState<HistoryFilter>({
+    search: '',
+    from: '',
+    to: '',
+    compressedOnly: false,
+    page: 0,
+  });
+  const [compressJobs, setCompressJobs] = useState<CompressJob[]>([]);
+  const [sessions, setSessions] = useState<Session[]>([]);
+  const [devices, setDevices] = useState<ApprovedDevice[]>([]);
+  const [approvals, setApprovals] = useState<ApprovalRequest[]>([]);
+  const [shared, setShared] = useState<SharedFile[]>([]);
+  const [texts, setTexts] = useState<TextMessage[]>([]);
+  const [textDraft, setTextDraft] = useState('');
+  const [autoCopy, setAutoCopy] = useState(false);
+  const [duplicateMode, setDuplicateModeState] = useState('keep');
+  const [conflictPolicy, setConflictPolicyState] = useState('rename');
+  const [folderTemplate, setFolderTemplateState] = useState('');
+  const [renameTemplate, setRenameTemplateState] = useState('');
+  const [renamePreview, setRenamePreview] = useState('');
+  const [typeLists, setTypeLists] = useState({ allow: '', deny: '' });
+  const [rules, setRules] = useState<main.UploadRule[]>([]);
+  const [ruleDraft, setRuleDraft] = useState<RuleDraft | null>(null);
+  const [ruleError, setRuleError] = useState('');
+  const [ruleTest, setRuleTest] = useState({ fileName: '', sizeMB: '', device: '' });
+  const [ruleTestResult, setRuleTestResult] = useState<main.RuleMatch | null>(null);
   const [lang, setLangState] = useState<Lang>('ja');
   const [compress, setCompress] = useState<CompressSettings>({
     compressImages: false,
     imageQuality: 80,
     keepOriginal: false,
+    maxDimension: 0,
+    heicOutput: 'jpeg',
+    convertHEIC: false,
+    privacyMode: false,
+    outputFormat: 'keep',
+    pngToWebp: false,
   });
 
   const t = useCallback((key: TranslationKey) => getTranslation(lang, key), [lang]);
@@ -63,13 +233,280 @@ function App() {
 
   const refreshHistory = useCallback(async () => {
     try {
-      const h = await GetUploadHistory();
-      setHistory((h || []) as unknown as UploadRecord[]);
+      const res = await QueryUploadHistory(main.HistoryQuery.createFrom({
+        ...historyFilter,
+        pageSize: HISTORY_PAGE_SIZE,
+      }));
+      setHistory((res?.records || []) as UploadRecord[]);
+      setHistoryTotal(res?.total ?? 0);
     } catch (e) {
       console.error('Failed to get history:', e);
     }
+  }, [historyFilter]);
+
+  const updateHistoryFilter = (updates: Partial<HistoryFilter>) => {
+    // Any filter change goes back to the first page
+    setHistoryFilter(prev => ({ ...prev, page: 0, ...updates }));
+  };
+
+  const refreshSessions = useCallback(async () => {
+    try {
+      const list = await GetSessions();
+      setSessions((list || []) as unknown as Session[]);
+    } catch (e) {
+      console.error('Failed to get sessions:', e);
+    }
+  }, []);
+
+  const refreshDevices = useCallback(async () => {
+    try {
+      const list = await GetApprovedDevices();
+      setDevices((list || []) as unknown as ApprovedDevice[]);
+    } catch (e) {
+      console.error('Failed to get approved devices:', e);
+    }
+  }, []);
+
+  const handleApproval = async (id: string, accept: boolean) => {
+    setApprovals(prev => prev.filter(a => a.id !== id));
+    try {
+      await RespondDeviceApproval(id, accept);
+      await refreshDevices();
+    } catch (e) {
+      console.error('Failed to answer approval request:', e);
+    }
+  };
+
+  const handleForgetDevice = async (id: string) => {
+    try {
+      await ForgetDevice(id);
+      await refreshDevices();
+    } catch (e) {
+      console.error('Failed to forget device:', e);
+    }
+  };
+
+  const refreshShared = useCallback(async () => {
+    try {
+      const list = await GetSharedFiles();
+      setShared((list || []) as unknown as SharedFile[]);
+    } catch (e) {
+      console.error('Failed to get shared files:', e);
+    }
+  }, []);
+
+  const handleShareFiles = async () => {
+    try {
+      await ShareFiles();
+      await refreshShared();
+    } catch (e) {
+      console.error('Failed to share files:', e);
+    }
+  };
+
+  const handleRemoveShared = async (id: string) => {
+    try {
+      await RemoveSharedFile(id);
+      await refreshShared();
+    } catch (e) {
+      console.error('Failed to remove shared file:', e);
+    }
+  };
+
+  const refreshTexts = useCallback(async () => {
+    try {
+      const list = await GetTextHistory();
+      setTexts((list || []) as unknown as TextMessage[]);
+      setAutoCopy(await GetAutoCopyText());
+    } catch (e) {
+      console.error('Failed to get text history:', e);
+    }
   }, []);
 
+  const handleSendText = async () => {
+    if (!textDraft.trim()) return;
+    try {
+      await SendTextToPhone(textDraft);
+      setTextDraft('');
+      await refreshTexts();
+    } catch (e) {
+      console.error('Failed to send text:', e);
+    }
+  };
+
+  const handleCopyText = async (text: string) => {
+    try {
+      await CopyTextToClipboard(text);
+    } catch (e) {
+      console.error('Failed to copy text:', e);
+    }
+  };
+
+  const handleAutoCopyChange = async (enabled: boolean) => {
+    setAutoCopy(enabled);
+    try {
+      await SetAutoCopyText(enabled);
+    } catch (e) {
+      console.error('Failed to save auto copy setting:', e);
+    }
+  };
+
+  const handleHTTPSChange = async (enabled: boolean) => {
+    try {
+      await SetUseHTTPS(enabled);
+      await refreshInfo();
+    } catch (e) {
+      console.error('Failed to switch HTTPS:', e);
+    }
+  };
+
+  const handleRevoke = async (id: string) => {
+    try {
+      await RevokeSession(id);
+    } catch (e) {
+      console.error('Failed to revoke session:', e);
+    }
+  };
+
+  const handleRevokeAll = async () => {
+    try {
+      await RevokeAllSessions();
+    } catch (e) {
+      console.error('Failed to revoke sessions:', e);
+    }
+  };
+
+  const refreshDuplicateMode = useCallback(async () => {
+    try {
+      setDuplicateModeState(await GetDuplicateMode());
+      setConflictPolicyState(await GetConflictPolicy());
+      setFolderTemplateState(await GetFolderTemplate());
+      setRenameTemplateState(await GetRenameTemplate());
+      const lists = await GetFileTypeLists();
+      setTypeLists({ allow: (lists.allow || []).join(', '), deny: (lists.deny || []).join(', ') });
+    } catch (e) {
+      console.error('Failed to get duplicate mode:', e);
+    }
+  }, []);
+
+  const handleDuplicateModeChange = async (mode: string) => {
+    setDuplicateModeState(mode);
+    try {
+      await SetDuplicateMode(mode);
+    } catch (e) {
+      console.error('Failed to save duplicate mode:', e);
+    }
+  };
+
+  const handleConflictPolicyChange = async (policy: string) => {
+    setConflictPolicyState(policy);
+    try {
+      await SetConflictPolicy(policy);
+    } catch (e) {
+      console.error('Failed to save conflict policy:', e);
+    }
+  };
+
+  const handleFolderTemplateSave = async () => {
+    try {
+      await SetFolderTemplate(folderTemplate);
+    } catch (e) {
+      console.error('Failed to save folder template:', e);
+    }
+    // Show the template as the backend normalized it, or the previous one on error
+    setFolderTemplateState(await GetFolderTemplate());
+  };
+
+  const handleRenameTemplateSave = async () => {
+    try {
+      await SetRenameTemplate(renameTemplate);
+    } catch (e) {
+      console.error('Failed to save rename template:', e);
+    }
+    setRenameTemplateState(await GetRenameTemplate());
+  };
+
+  const handleTypeListsSave = async () => {
+    const list = (s: string) => s.split(',').map(v => v.trim()).filter(v => v !== '');
+    try {
+      await SetFileTypeLists(list(typeLists.allow), list(typeLists.deny));
+    } catch (e) {
+      console.error('Failed to save file type lists:', e);
+    }
+    const lists = await GetFileTypeLists();
+    setTypeLists({ allow: (lists.allow || []).join(', '), deny: (lists.deny || []).join(', ') });
+  };
+
+  useEffect(() => {
+    PreviewRenameTemplate(renameTemplate, RENAME_SAMPLE)
+      .then(name => setRenamePreview(`${RENAME_SAMPLE} → ${name}`))
+      .catch(e => setRenamePreview(String(e)));
+  }, [renameTemplate]);
+
+  const refreshRules = useCallback(async () => {
+    try {
+      setRules((await GetUploadRules()) || []);
+    } catch (e) {
+      console.error('Failed to get upload rules:', e);
+    }
+  }, []);
+
+  const handleSaveRule = async () => {
+    if (!ruleDraft) return;
+    try {
+      await SaveUploadRule(draftToRule(ruleDraft));
+      setRuleDraft(null);
+      setRuleError('');
+      await refreshRules();
+    } catch (e) {
+      setRuleError(String(e));
+    }
+  };
+
+  const handleToggleRule = async (rule: main.UploadRule) => {
+    try {
+      await SaveUploadRule(main.UploadRule.createFrom({ ...rule, enabled: !rule.enabled }));
+      await refreshRules();
+    } catch (e) {
+      console.error('Failed to save upload rule:', e);
+    }
+  };
+
+  const handleDeleteRule = async (id: string) => {
+    try {
+      await DeleteUploadRule(id);
+      await refreshRules();
+    } catch (e) {
+      console.error('Failed to delete upload rule:', e);
+    }
+  };
+
+  const handleMoveRule = async (id: string, index: number) => {
+    try {
+      await MoveUploadRule(id, index);
+      await refreshRules();
+    } catch (e) {
+      console.error('Failed to move upload rule:', e);
+    }
+  };
+
+  const handleTestRules = async () => {
+    if (!ruleTest.fileName.trim()) return;
+    try {
+      setRuleTestResult(await TestUploadRules(
+        ruleTest.fileName,
+        Math.round((Number(ruleTest.sizeMB) || 0) * MB),
+        ruleTest.device,
+      ));
+    } catch (e) {
+      console.error('Failed to test upload rules:', e);
+    }
+  };
+
+  const updateRuleDraft = (updates: Partial<RuleDraft>) => {
+    setRuleDraft(prev => (prev ? { ...prev, ...updates } : prev));
+  };
+
   const refreshCompress = useCallback(async () => {
     try {
       const s = await GetCompressSettings();
@@ -84,28 +521,116 @@ function App() {
     const next = { ...compress, ...updates };
     setCompress(next);
     try {
-      await SetCompressSettings(next.compressImages, next.imageQuality, next.keepOriginal);
+      await SetCompressSettings(next.compressImages, next.imageQuality, next.keepOriginal, next.maxDimension);
     } catch (e) {
       console.error('Failed to save compress settings:', e);
     }
   };
 
+  const handleHEICChange = async (updates: Partial<CompressSettings>) => {
+    const next = { ...compress, ...updates };
+    setCompress(next);
+    try {
+      await SetHEICSettings(next.heicOutput, next.convertHEIC);
+    } catch (e) {
+      console.error('Failed to save HEIC settings:', e);
+    }
+  };
+
+  const handleOutputFormatChange = async (updates: Partial<CompressSettings>) => {
+    const next = { ...compress, ...updates };
+    setCompress(next);
+    try {
+      await SetOutputFormat(next.outputFormat, next.pngToWebp);
+    } catch (e) {
+      console.error('Failed to save output format:', e);
+    }
+  };
+
+  const handlePrivacyModeChange = async (enabled: boolean) => {
+    setCompress({ ...compress, privacyMode: enabled });
+    try {
+      await SetPrivacyMode(enabled);
+    } catch (e) {
+      console.error('Failed to save privacy mode:', e);
+    }
+  };
+
   useEffect(() => {
     refreshInfo();
-    refreshHistory();
     refreshCompress();
+    refreshDuplicateMode();
+    refreshRules();
+    refreshSessions();
+    refreshDevices();
+    refreshShared();
+    refreshTexts();
+
+    const cancelPairing = EventsOn('pairing:changed', () => {
+      refreshInfo();
+      refreshSessions();
+    });
+
+    const cancelApproval = EventsOn('device:approval', (req: ApprovalRequest) => {
+      setApprovals(prev => [...prev.filter(a => a.id !== req.id), req]);
+    });
+
+    const cancelApprovalResolved = EventsOn('device:approval-resolved', (id: string) => {
+      setApprovals(prev => prev.filter(a => a.id !== id));
+    });
+
+    const cancelText = EventsOn('text:received', () => {
+      refreshTexts();
+    });
+
+    const interval = setInterval(() => {
+      refreshInfo();
+      refreshShared();
+    }, 5000);
+
+    return () => {
+      cancelPairing();
+      cancelApproval();
+      cancelApprovalResolved();
+      cancelText();
+      clearInterval(interval);
+    };
+  }, [refreshInfo, refreshDuplicateMode, refreshRules, refreshSessions, refreshDevices, refreshShared, refreshTexts]);
+
+  useEffect(() => {
+    refreshHistory();
 
     const cancel = EventsOn('upload:completed', () => {
       refreshHistory();
     });
 
-    const interval = setInterval(refreshInfo, 5000);
+    return () => {
+      cancel();
+    };
+  }, [refreshHistory]);
+
+  useEffect(() => {
+    GetCompressQueue()
+      .then(jobs => setCompressJobs(jobs || []))
+      .catch(e => console.error('Failed to get compression queue:', e));
+
+    const cancel = EventsOn('compress:progress', (job: CompressJob) => {
+      if (job.state === 'failed') {
+        console.error(`Failed to save ${job.fileName}:`, job.error);
+      }
+      setCompressJobs(prev => {
+        const rest = prev.filter(j => j.id !== job.id);
+        if (job.state === 'done' || job.state === 'failed') {
+          return rest;
+        }
+        return [...rest, job].sort((a, b) => a.id - b.id);
+      });
+    });
 
     return () => {
       cancel();
-      clearInterval(interval);
     };
-  }, [refreshInfo, refreshHistory]);
+  }, []);
 
   const handleSetLang = async (newLang: Lang) => {
     setLangState(newLang);
@@ -135,6 +660,23 @@ function App() {
   return (
     <LanguageContext.Provider value={{ lang, setLang: handleSetLang, t }}>
       <div id="app">
+        {approvals.length > 0 && (
+          <div className="approval-overlay">
+            <div className="approval-dialog">
+              <div className="approval-title">
+                {t('acceptFilesFrom').replace('{name}', approvals[0].name)}
+              </div>
+              <div className="approval-buttons">
+                <button className="approval-decline" onClick={() => handleApproval(approvals[0].id, false)}>
+                  {t('decline')}
+                </button>
+                <button className="approval-accept" onClick={() => handleApproval(approvals[0].id, true)}>
+                  {t('accept')}
+                </button>
+              </div>
+            </div>
+          </div>
+        )}
         <div className="header">
           <div className="lang-switcher">
             <button
@@ -165,6 +707,11 @@ function App() {
             <div className="qr-wrapper">
               <QRCodeSVG value={url} size={180} level="M" />
             </div>
+            {serverInfo?.pin && (
+              <div className="pin-row">
+                {t('pairingPin')}: <span className="pin-value">{serverInfo.pin}</span>
+              </div>
+            )}
           </div>
         )}
 
@@ -178,6 +725,154 @@ function App() {
               {t('change')}
             </button>
           </div>
+          <div className="quality-row">
+            <span className="quality-label">{t('duplicateMode')}</span>
+            <select
+              className="setting-select"
+              value={duplicateMode}
+              onChange={(e) => handleDuplicateModeChange(e.target.value)}
+            >
+              <option value="keep">{t('duplicateKeep')}</option>
+              <option value="skip">{t('duplicateSkip')}</option>
+              <option value="link">{t('duplicateLink')}</option>
+            </select>
+          </div>
+          <div className="quality-row">
+            <span className="quality-label">{t('conflictPolicy')}</span>
+            <select
+              className="setting-select"
+              value={conflictPolicy}
+              onChange={(e) => handleConflictPolicyChange(e.target.value)}
+            >
+              <option value="rename">{t('conflictRename')}</option>
+              <option value="timestamp">{t('conflictTimestamp')}</option>
+              <option value="overwrite">{t('conflictOverwrite')}</option>
+              <option value="skip">{t('conflictSkip')}</option>
+              <option value="newer">{t('conflictNewer')}</option>
+            </select>
+          </div>
+          <div className="quality-row">
+            <span className="quality-label">{t('folderTemplate')}</span>
+            <input
+              type="text"
+              className="setting-select"
+              value={folderTemplate}
+              placeholder="{yyyy}/{MM}/{dd}"
+              title={t('folderTemplateHint')}
+              onChange={(e) => setFolderTemplateState(e.target.value)}
+              onBlur={handleFolderTemplateSave}
+              onKeyDown={(e) => e.key === 'Enter' && e.currentTarget.blur()}
+            />
+          </div>
+          <div className="quality-row">
+            <span className="quality-label">{t('renameTemplate')}</span>
+            <input
+              type="text"
+              className="setting-select"
+              value={renameTemplate}
+              placeholder="{date}_{time}_{original}"
+              title={t('renameTemplateHint')}
+              onChange={(e) => setRenameTemplateState(e.target.value)}
+              onBlur={handleRenameTemplateSave}
+              onKeyDown={(e) => e.key === 'Enter' && e.currentTarget.blur()}
+            />
+          </div>
+          {renameTemplate && <div className="file-meta rule-test-result">{renamePreview}</div>}
+          <div className="quality-row">
+            <span className="quality-label">{t('allowTypes')}</span>
+            <input
+              type="text"
+              className="setting-select"
+              value={typeLists.allow}
+              placeholder={t('allTypes')}
+              title={t('typeListHint')}
+              onChange={(e) => setTypeLists({ ...typeLists, allow: e.target.value })}
+              onBlur={handleTypeListsSave}
+              onKeyDown={(e) => e.key === 'Enter' && e.currentTarget.blur()}
+            />
+          </div>
+          <div className="quality-row">
+            <span className="quality-label">{t('denyTypes')}</span>
+            <input
+              type="text"
+              className="setting-select"
+              value={typeLists.deny}
+              placeholder="executable, script"
+              title={t('typeListHint')}
+              onChange={(e) => setTypeLists({ ...typeLists, deny: e.target.value })}
+              onBlur={handleTypeListsSave}
+              onKeyDown={(e) => e.key === 'Enter' && e.currentTarget.blur()}
+            />
+          </div>
+        </div>
+
+        <div className="history-section">
+          <div className="label-row">
+            <div className="label">{t('sendToPhone')}</div>
+            <button className="change-btn" onClick={handleShareFiles}>
+              {t('addFiles')}
+            </button>
+          </div>
+          {shared.length === 0 ? (
+            <div className="empty-history">{t('noSharedFiles')}</div>
+          ) : (
+            shared.map((f) => (
+              <div key={f.id} className="history-item">
+                <div className="file-info">
+                  <div className="file-name" title={f.path}>
+                    {f.name}
+                  </div>
+                  <div className="file-meta">
+                    {t('expires')}: {f.expiresAt}
+                  </div>
+                </div>
+                <div className="file-size">{formatSize(f.size)}</div>
+                <button className="revoke-btn" onClick={() => handleRemoveShared(f.id)}>
+                  {t('remove')}
+                </button>
+              </div>
+            ))
+          )}
+        </div>
+
+        <div className="history-section">
+          <div className="label">{t('textChannel')}</div>
+          <div className="text-send-row">
+            <textarea
+              className="text-input"
+              value={textDraft}
+              placeholder={t('textToPhone')}
+              onChange={(e) => setTextDraft(e.target.value)}
+            />
+            <button className="change-btn" onClick={handleSendText} disabled={!textDraft.trim()}>
+              {t('send')}
+            </button>
+          </div>
+          <label className="compress-toggle">
+            <input
+              type="checkbox"
+              checked={autoCopy}
+              onChange={(e) => handleAutoCopyChange(e.target.checked)}
+            />
+            <span>{t('autoCopyText')}</span>
+          </label>
+          {texts.length === 0 ? (
+            <div className="empty-history">{t('noTexts')}</div>
+          ) : (
+            texts.map((m) => (
+              <div key={m.id} className="history-item">
+                <div className="file-info">
+                  <div className="text-body">{m.text}</div>
+                  <div className="file-meta">
+                    {m.from === 'phone' ? `${t('fromPhone')} ${m.device ?? ''}` : t('fromPC')} · {m.timestamp}
+                  </div>
+                </div>
+                <button className="revoke-btn" onClick={() => handleCopyText(m.text)}>
+                  {t('copy')}
+                </button>
+              </div>
+            ))
+          )}
         </div>
 
         <details className="compress-section">
@@ -214,35 +909,396 @@ function App() {
                   />
                   <span>{t('keepOriginal')}</span>
                 </label>
+                <div className="quality-row">
+                  <span className="quality-label">{t('maxDimension')}</span>
+                  <select
+                    className="setting-select"
+                    value={compress.maxDimension}
+                    onChange={(e) => handleCompressChange({ maxDimension: Number(e.target.value) })}
+                  >
+                    <option value={0}>{t('noResize')}</option>
+                    <option value={2048}>2048 px</option>
+                    <option value={3072}>3072 px</option>
+                    <option value={4096}>4096 px</option>
+                  </select>
+                </div>
+                <div className="quality-row">
+                  <span className="quality-label">{t('outputFormat')}</span>
+                  <select
+                    className="setting-select"
+                    value={compress.outputFormat}
+                    onChange={(e) => handleOutputFormatChange({ outputFormat: e.target.value })}
+                  >
+                    <option value="keep">{t('formatKeep')}</option>
+                    <option value="jpeg">JPEG</option>
+                    <option value="webp">WebP</option>
+                    <option value="avif">{t('formatAVIF')}</option>
+                  </select>
+                </div>
+                {(compress.outputFormat === 'keep' || compress.outputFormat === 'webp') && (
+                  <label className="compress-toggle">
+                    <input
+                      type="checkbox"
+                      checked={compress.pngToWebp}
+                      onChange={(e) => handleOutputFormatChange({ pngToWebp: e.target.checked })}
+                    />
+                    <span>{t('pngToWebp')}</span>
+                  </label>
+                )}
+                <div className="quality-row">
+                  <span className="quality-label">{t('heicOutput')}</span>
+                  <select
+                    className="setting-select"
+                    value={compress.heicOutput}
+                    onChange={(e) => handleHEICChange({ heicOutput: e.target.value })}
+                  >
+                    <option value="jpeg">{t('heicToJpeg')}</option>
+                    <option value="keep">{t('heicKeep')}</option>
+                  </select>
+                </div>
               </>
             )}
+            <label className="compress-toggle">
+              <input
+                type="checkbox"
+                checked={compress.convertHEIC}
+                onChange={(e) => handleHEICChange({ convertHEIC: e.target.checked })}
+              />
+              <span>{t('alwaysConvertHEIC')}</span>
+            </label>
+            <label className="compress-toggle">
+              <input
+                type="checkbox"
+                checked={compress.privacyMode}
+                onChange={(e) => handlePrivacyModeChange(e.target.checked)}
+              />
+              <span>{t('privacyMode')}</span>
+            </label>
+          </div>
+        </details>
+
+        <details className="compress-section">
+          <summary className="compress-summary">
+            {t('uploadRules')} ({rules.length})
+          </summary>
+          <div className="compress-body">
+            {rules.length === 0 ? (
+              <div className="empty-history">{t('noUploadRules')}</div>
+            ) : (
+              rules.map((r, i) => (
+                <div key={r.id} className="history-item">
+                  <input
+                    type="checkbox"
+                    className="rule-enabled"
+                    checked={r.enabled}
+                    onChange={() => handleToggleRule(r)}
+                  />
+                  <div className="file-info">
+                    <div className="file-name">{r.name}</div>
+                    <div className="file-meta">→ {r.saveDir || t('defaultSaveDir')}</div>
+                  </div>
+                  <button className="revoke-btn" disabled={i === 0} onClick={() => handleMoveRule(r.id, i - 1)}>↑</button>
+                  <button className="revoke-btn" disabled={i === rules.length - 1} onClick={() => handleMoveRule(r.id, i + 1)}>↓</button>
+                  <button className="revoke-btn" onClick={() => { setRuleDraft(ruleToDraft(r)); setRuleError(''); }}>
+                    {t('edit')}
+                  </button>
+                  <button className="revoke-btn" onClick={() => handleDeleteRule(r.id)}>
+                    {t('remove')}
+                  </button>
+                </div>
+              ))
+            )}
+            {ruleDraft ? (
+              <div className="rule-editor">
+                <div className="quality-row">
+                  <span className="quality-label">{t('ruleName')}</span>
+                  <input type="text" className="setting-select" value={ruleDraft.name}
+                    onChange={(e) => updateRuleDraft({ name: e.target.value })} />
+                </div>
+                <div className="sub-label">{t('ruleConditions')}</div>
+                <div className="quality-row">
+                  <span className="quality-label">{t('ruleExtensions')}</span>
+                  <input type="text" className="setting-select" value={ruleDraft.extensions} placeholder=".mp4, .mov"
+                    onChange={(e) => updateRuleDraft({ extensions: e.target.value })} />
+                </div>
+                <div className="quality-row">
+                  <span className="quality-label">{t('ruleMimeTypes')}</span>
+                  <input type="text" className="setting-select" value={ruleDraft.mimeTypes} placeholder="video/*, application/pdf"
+                    onChange={(e) => updateRuleDraft({ mimeTypes: e.target.value })} />
+                </div>
+                <div className="quality-row">
+                  <span className="quality-label">{t('ruleNameGlob')}</span>
+                  <input type="text" className="setting-select" value={ruleDraft.nameGlob} placeholder="Screenshot*"
+                    onChange={(e) => updateRuleDraft({ nameGlob: e.target.value })} />
+                </div>
+                <div className="quality-row">
+                  <span className="quality-label">{t('ruleNameRegex')}</span>
+                  <input type="text" className="setting-select" value={ruleDraft.nameRegex} placeholder="^IMG_\d+"
+                    onChange={(e) => updateRuleDraft({ nameRegex: e.target.value })} />
+                </div>
+                <div className="quality-row">
+                  <span className="quality-label">{t('ruleSizeMB')}</span>
+                  <input type="number" min={0} className="setting-select" value={ruleDraft.minSizeMB} placeholder="0"
+                    onChange={(e) => updateRuleDraft({ minSizeMB: e.target.value })} />
+                  <span className="quality-label">–</span>
+                  <input type="number" min={0} className="setting-select" value={ruleDraft.maxSizeMB} placeholder="∞"
+                    onChange={(e) => updateRuleDraft({ maxSizeMB: e.target.value })} />
+                </div>
+                <div className="quality-row">
+                  <span className="quality-label">{t('ruleDevice')}</span>
+                  <input type="text" className="setting-select" value={ruleDraft.device} placeholder="iPhone"
+                    onChange={(e) => updateRuleDraft({ device: e.target.value })} />
+                </div>
+                <div className="sub-label">{t('ruleActions')}</div>
+                <div className="quality-row">
+                  <span className="quality-label">{t('ruleSaveDir')}</span>
+                  <input type="text" className="setting-select" value={ruleDraft.saveDir} placeholder={t('defaultSaveDir')}
+                    onChange={(e) => updateRuleDraft({ saveDir: e.target.value })} />
+                </div>
+                <div className="quality-row">
+                  <span className="quality-label">{t('imageCompression')}</span>
+                  <select className="setting-select" value={ruleDraft.compress}
+                    onChange={(e) => updateRuleDraft({ compress: e.target.value })}>
+                    <option value="">{t('ruleCompressDefault')}</option>
+                    <option value="on">{t('ruleCompressOn')}</option>
+                    <option value="off">{t('ruleCompressOff')}</option>
+                  </select>
+                </div>
+                <div className="quality-row">
+                  <span className="quality-label">{t('ruleRename')}</span>
+                  <input type="text" className="setting-select" value={ruleDraft.renameTemplate}
+                    placeholder="{date}_{original}" title={t('ruleRenameHint')}
+                    onChange={(e) => updateRuleDraft({ renameTemplate: e.target.value })} />
+                </div>
+                {ruleError && <div className="rule-error">{ruleError}</div>}
+                <div className="quality-row">
+                  <button className="revoke-btn" onClick={handleSaveRule}>{t('save')}</button>
+                  <button className="revoke-btn" onClick={() => setRuleDraft(null)}>{t('cancel')}</button>
+                </div>
+              </div>
+            ) : (
+              <button className="revoke-btn revoke-all" onClick={() => { setRuleDraft(ruleToDraft()); setRuleError(''); }}>
+                {t('addRule')}
+              </button>
+            )}
+            <div className="sub-label">{t('testRules')}</div>
+            <div className="quality-row">
+              <input type="text" className="setting-select" value={ruleTest.fileName} placeholder="IMG_0001.MOV"
+                onChange={(e) => setRuleTest({ ...ruleTest, fileName: e.target.value })} />
+              <input type="number" min={0} className="setting-select" value={ruleTest.sizeMB} placeholder="MB"
+                onChange={(e) => setRuleTest({ ...ruleTest, sizeMB: e.target.value })} />
+              <input type="text" className="setting-select" value={ruleTest.device} placeholder={t('ruleDevice')}
+                onChange={(e) => setRuleTest({ ...ruleTest, device: e.target.value })} />
+              <button className="revoke-btn" onClick={handleTestRules}>{t('test')}</button>
+            </div>
+            {ruleTestResult && (
+              <div className="file-meta rule-test-result">
+                {ruleTestResult.ruleName ? `${ruleTestResult.ruleName}: ` : `${t('noRuleMatched')}: `}
+                {ruleTestResult.saveDir} / {ruleTestResult.fileName}
+                {ruleTestResult.compress ? ` · ${t('ruleCompressOn')}` : ''}
+                {ruleTestResult.mimeType ? ` · ${ruleTestResult.mimeType}` : ''}
+              </div>
+            )}
+          </div>
+        </details>
+
+        <details className="compress-section">
+          <summary className="compress-summary">{t('connectionSecurity')}</summary>
+          <div className="compress-body">
+            <label className="compress-toggle">
+              <input
+                type="checkbox"
+                checked={serverInfo?.https ?? false}
+                onChange={(e) => handleHTTPSChange(e.target.checked)}
+              />
+              <span>{t('useHTTPS')}</span>
+            </label>
+            {serverInfo?.https && serverInfo.certFingerprint && (
+              <div className="fingerprint">
+                <div className="sub-label">{t('certFingerprint')}</div>
+                <code>{serverInfo.certFingerprint}</code>
+              </div>
+            )}
+          </div>
+        </details>
+
+        <details className="compress-section">
+          <summary className="compress-summary">
+            {t('pairedDevices')} ({sessions.length})
+          </summary>
+          <div className="compress-body">
+            {sessions.length === 0 ? (
+              <div className="empty-history">{t('noPairedDevices')}</div>
+            ) : (
+              <>
+                {sessions.map((s) => (
+                  <div key={s.id} className="history-item">
+                    <div className="file-info">
+                      <div className="file-name" title={s.userAgent}>
+                        {s.address}
+                      </div>
+                      <div className="file-meta">
+                        {s.created} – {s.expires}
+                      </div>
+                    </div>
+                    <button className="revoke-btn" onClick={() => handleRevoke(s.id)}>
+                      {t('revoke')}
+                    </button>
+                  </div>
+                ))}
+                <button className="revoke-btn revoke-all" onClick={handleRevokeAll}>
+                  {t('revokeAll')}
+                </button>
+              </>
+            )}
+            <div className="sub-label">{t('approvedDevices')}</div>
+            {devices.length === 0 ? (
+              <div className="empty-history">{t('noApprovedDevices')}</div>
+            ) : (
+              devices.map((d) => (
+                <div key={d.id} className="history-item">
+                  <div className="file-info">
+                    <div className="file-name">{d.name}</div>
+                    <div className="file-meta">{d.approvedAt}</div>
+                  </div>
+                  <button className="revoke-btn" onClick={() => handleForgetDevice(d.id)}>
+                    {t('forget')}
+                  </button>
+                </div>
+              ))
+            )}
           </div>
         </details>
 
         <div className="history-section">
           <div className="label">{t('recentUploads')}</div>
+          <div className="history-filters">
+            <input
+              type="search"
+              className="history-search"
+              placeholder={t('searchHistory')}
+              value={historyFilter.search}
+              onChange={(e) => updateHistoryFilter({ search: e.target.value })}
+            />
+            <div className="history-filter-row">
+              <input
+                type="date"
+                value={historyFilter.from}
+                onChange={(e) => updateHistoryFilter({ from: e.target.value })}
+              />
+              <span>–</span>
+              <input
+                type="date"
+                value={historyFilter.to}
+                onChange={(e) => updateHistoryFilter({ to: e.target.value })}
+              />
+            </div>
+            <label className="compress-toggle">
+              <input
+                type="checkbox"
+                checked={historyFilter.compressedOnly}
+                onChange={(e) => updateHistoryFilter({ compressedOnly: e.target.checked })}
+              />
+              <span>{t('compressedOnly')}</span>
+            </label>
+          </div>
+          {compressJobs.length > 0 && (
+            <div className="compress-queue">
+              <div className="compress-queue-title">
+                {t('compressing')} ({compressJobs.length})
+              </div>
+              {compressJobs.slice(0, 5).map(job => (
+                <div key={job.id} className="compress-queue-item">
+                  <span className="file-name">{job.fileName}</span>
+                  <span className="compress-badge">
+                    {job.state === 'compressing' ? t('compressRunning') : t('compressQueued')}
+                  </span>
+                </div>
+              ))}
+            </div>
+          )}
           {history.length === 0 ? (
             <div className="empty-history">{t('noFiles')}</div>
           ) : (
             history.map((record, i) => (
               <div key={i} className="history-item">
                 <div className="file-info">
-                  <div className="file-name" title={record.fileName}>
+                  <div className="file-name" title={record.savePath}>
+                    {record.folder ? `${record.folder}/` : null}
                     {record.fileName}
                   </div>
                   <div className="file-meta">
                     {record.timestamp}
+                    {record.device ? ` · ${record.device}` : null}
+                    {record.rule ? ` · ${record.rule}` : null}
                     {record.compressed && record.originalSize ? (
                       <span className="compress-badge">
                         {' '}({formatSize(record.originalSize)} → {formatSize(record.size)})
                       </span>
                     ) : null}
+                    {record.metadataStripped && (
+                      <span className="compress-badge"> {t('metadataStripped')}</span>
+                    )}
+                    {record.conflictAction === 'renamed' && (
+                      <span className="compress-badge"> {t('renamed')}</span>
+                    )}
+                    {record.conflictAction === 'skipped' && (
+                      <span className="compress-badge"> {t('skipped')}</span>
+                    )}
+                    {record.conflictAction === 'overwritten' && (
+                      <span className="missing-badge"> {t('overwritten')}</span>
+                    )}
+                    {record.extMismatch === 'fixed' && (
+                      <span className="compress-badge" title={record.contentType}> {t('extFixed')}</span>
+                    )}
+                    {record.extMismatch === 'flagged' && (
+                      <span className="missing-badge" title={record.contentType}> {t('extFlagged')}</span>
+                    )}
+                    {record.duplicateOf && record.status === 'duplicate' && (
+                      <span className="compress-badge" title={record.duplicateOf}> {t('duplicateSkipped')}</span>
+                    )}
+                    {record.duplicateOf && record.status !== 'duplicate' && (
+                      <span className="compress-badge" title={record.duplicateOf}> {t('hardLinked')}</span>
+                    )}
+                    {record.sha256 && (
+                      <span
+                        className="checksum"
+                        title={`SHA-256 ${record.sha256}`}
+                        onClick={() => CopyTextToClipboard(record.sha256 || '')}
+                      >
+                        {' '}SHA-256 {record.sha256.slice(0, 12)}…
+                      </span>
+                    )}
+                    {!record.exists && (
+                      <span className="missing-badge"> {t('fileMissing')}</span>
+                    )}
                   </div>
                 </div>
                 <div className="file-size">{formatSize(record.size)}</div>
               </div>
             ))
           )}
+          {historyTotal > HISTORY_PAGE_SIZE && (
+            <div className="history-pager">
+              <button
+                className="change-btn"
+                disabled={historyFilter.page === 0}
+                onClick={() => setHistoryFilter(prev => ({ ...prev, page: prev.page - 1 }))}
+              >
+                ‹
+              </button>
+              <span>
+                {historyFilter.page + 1} / {Math.ceil(historyTotal / HISTORY_PAGE_SIZE)}
+              </span>
+              <button
+                className="change-btn"
+                disabled={(historyFilter.page + 1) * HISTORY_PAGE_SIZE >= historyTotal}
+                onClick={() => setHistoryFilter(prev => ({ ...prev, page: prev.page + 1 }))}
+              >
+                ›
+              </button>
+            </div>
+          )}
         </div>
 
         <div className="warning-box">
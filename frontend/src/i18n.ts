@@ -8,6 +8,31 @@ const translations = {
     serverRunning: 'サーバー起動中',
     serverStopped: 'サーバー停止中',
     saveLocation: '保存先',
+    duplicateMode: '重複ファイル',
+    duplicateKeep: '両方保存',
+    duplicateSkip: 'スキップ',
+    duplicateLink: 'ハードリンク',
+    hardLinked: 'ハードリンク',
+    duplicateSkipped: '重複のためスキップ',
+    conflictPolicy: '同名ファイル',
+    conflictRename: '番号を付ける',
+    conflictTimestamp: '日時を付ける',
+    conflictOverwrite: '上書き',
+    conflictSkip: 'スキップ',
+    conflictNewer: '新しい方を残す',
+    renamed: '名前変更',
+    overwritten: '上書き',
+    skipped: 'スキップ',
+    folderTemplate: '日付フォルダ',
+    renameTemplate: 'ファイル名',
+    allowTypes: '受け付ける形式',
+    denyTypes: '拒否する形式',
+    allTypes: 'すべて',
+    typeListHint: 'ファイルの中身から判定した形式をカンマ区切りで指定（例: image/*, video/*, application/pdf, executable, script）',
+    extFixed: '拡張子を修正',
+    extFlagged: '拡張子と内容が不一致',
+    renameTemplateHint: '{date} {time} {device} {original} {counter} {ext} {hash8} が使えます。空欄でスマホのファイル名のまま',
+    folderTemplateHint: '撮影日（なければ更新日時）でフォルダ分けします。{yyyy} {yy} {MM} {dd} が使えます。空欄で無効',
     notSet: '未設定',
     change: '変更',
     recentUploads: '受信履歴',
@@ -18,14 +43,109 @@ const translations = {
     compressImages: '保存前に画像を圧縮',
     imageQuality: '画質',
     keepOriginal: '元画像も保存',
+    maxDimension: '最大サイズ',
+    noResize: '縮小しない',
+    outputFormat: '保存形式',
+    formatKeep: '元の形式（HEICはJPEG）',
+    formatAVIF: 'AVIF（メタデータ付きはWebP）',
+    pngToWebp: 'PNGをロスレスWebPで保存',
+    heicOutput: 'HEIC',
+    heicToJpeg: 'JPEGに変換',
+    heicKeep: 'そのまま保存',
+    alwaysConvertHEIC: 'HEICを常にJPEGに変換（圧縮オフでも）',
+    privacyMode: '位置情報・個人情報を削除（GPS、シリアル番号、所有者名）',
+    metadataStripped: '位置情報削除済み',
     compressed: '圧縮済み',
     compressionFailed: '圧縮失敗（元ファイルを保存）',
+    pairingPin: 'ペアリングPIN',
+    pairedDevices: '接続済みデバイス',
+    noPairedDevices: '接続済みのデバイスはありません',
+    revoke: '解除',
+    revokeAll: 'すべて解除',
+    approvedDevices: '承認済みデバイス',
+    noApprovedDevices: '承認済みのデバイスはありません',
+    forget: '削除',
+    acceptFilesFrom: '{name} からのファイルを受け取りますか？',
+    accept: '受け取る',
+    decline: '拒否',
+    connectionSecurity: '通信の暗号化',
+    useHTTPS: 'HTTPSを使用（自己署名証明書）',
+    certFingerprint: '証明書フィンガープリント (SHA-256)',
+    sendToPhone: 'スマホに送る',
+    addFiles: 'ファイルを追加',
+    noSharedFiles: '共有中のファイルはありません',
+    expires: '有効期限',
+    remove: '削除',
+    textChannel: 'テキスト',
+    textToPhone: 'スマホに送るテキスト',
+    send: '送信',
+    autoCopyText: '受信したテキストを自動でクリップボードにコピー',
+    noTexts: 'テキストの送受信はまだありません',
+    fromPhone: 'スマホから',
+    fromPC: 'PCから',
+    copy: 'コピー',
+    searchHistory: 'ファイル名・デバイスで検索',
+    compressedOnly: '圧縮したファイルのみ',
+    fileMissing: '（ファイルなし）',
+    compressing: '画像を圧縮中',
+    compressRunning: '圧縮中',
+    uploadRules: '振り分けルール',
+    noUploadRules: 'ルールはありません（すべて保存先に保存）',
+    defaultSaveDir: '保存先',
+    addRule: 'ルールを追加',
+    edit: '編集',
+    save: '保存',
+    cancel: 'キャンセル',
+    ruleName: '名前',
+    ruleConditions: '条件（すべて満たす場合に適用、空欄は条件なし）',
+    ruleExtensions: '拡張子',
+    ruleMimeTypes: 'ファイル形式',
+    ruleNameGlob: 'ファイル名',
+    ruleNameRegex: '正規表現',
+    ruleSizeMB: 'サイズ (MB)',
+    ruleDevice: 'デバイス',
+    ruleActions: '処理',
+    ruleSaveDir: '保存先フォルダ',
+    ruleCompressDefault: '設定に従う',
+    ruleCompressOn: '圧縮する',
+    ruleCompressOff: '圧縮しない',
+    ruleRename: '名前の変更',
+    ruleRenameHint: '空欄は「ファイル名」の設定に従います',
+    testRules: 'ルールを試す',
+    test: '試す',
+    noRuleMatched: '該当ルールなし',
+    compressQueued: '待機中',
   },
   en: {
     appTitle: 'File Bridge',
     serverRunning: 'Server Running',
     serverStopped: 'Server Stopped',
     saveLocation: 'Save Location',
+    duplicateMode: 'Duplicates',
+    duplicateKeep: 'Keep both',
+    duplicateSkip: 'Skip',
+    duplicateLink: 'Hard link',
+    hardLinked: 'hard link',
+    duplicateSkipped: 'skipped, duplicate',
+    conflictPolicy: 'Same name',
+    conflictRename: 'Add a number',
+    conflictTimestamp: 'Add date and time',
+    conflictOverwrite: 'Overwrite',
+    conflictSkip: 'Skip',
+    conflictNewer: 'Keep newer',
+    renamed: 'renamed',
+    overwritten: 'overwritten',
+    skipped: 'skipped',
+    folderTemplate: 'Date folders',
+    renameTemplate: 'File names',
+    allowTypes: 'Accepted types',
+    denyTypes: 'Blocked types',
+    allTypes: 'all',
+    typeListHint: 'Comma-separated types detected from the file content, e.g. image/*, video/*, application/pdf, executable, script',
+    extFixed: 'extension fixed',
+    extFlagged: 'extension does not match content',
+    renameTemplateHint: 'Use {date} {time} {device} {original} {counter} {ext} {hash8}; leave empty to keep the phone\'s names',
+    folderTemplateHint: 'Sort uploads by the date taken (or last modified). Use {yyyy} {yy} {MM} {dd}; leave empty to turn off',
     notSet: 'Not set',
     change: 'Change',
     recentUploads: 'Recent Uploads',
@@ -36,8 +156,78 @@ const translations = {
     compressImages: 'Compress images before saving',
     imageQuality: 'Quality',
     keepOriginal: 'Keep original copy',
+    maxDimension: 'Max size',
+    noResize: 'Original size',
+    outputFormat: 'Save as',
+    formatKeep: 'Same as source (HEIC as JPEG)',
+    formatAVIF: 'AVIF (WebP if it has metadata)',
+    pngToWebp: 'Save PNG as lossless WebP',
+    heicOutput: 'HEIC',
+    heicToJpeg: 'Convert to JPEG',
+    heicKeep: 'Keep as HEIC',
+    alwaysConvertHEIC: 'Always convert HEIC to JPEG (even with compression off)',
+    privacyMode: 'Strip location and personal data (GPS, serial numbers, owner name)',
+    metadataStripped: 'metadata stripped',
     compressed: 'Compressed',
     compressionFailed: 'Compression failed (original saved)',
+    pairingPin: 'Pairing PIN',
+    pairedDevices: 'Paired Devices',
+    noPairedDevices: 'No paired devices',
+    revoke: 'Revoke',
+    revokeAll: 'Revoke all',
+    approvedDevices: 'Approved Devices',
+    noApprovedDevices: 'No approved devices',
+    forget: 'Forget',
+    acceptFilesFrom: 'Accept files from {name}?',
+    accept: 'Accept',
+    decline: 'Decline',
+    connectionSecurity: 'Connection Security',
+    useHTTPS: 'Use HTTPS (self-signed certificate)',
+    certFingerprint: 'Certificate fingerprint (SHA-256)',
+    sendToPhone: 'Send to Phone',
+    addFiles: 'Add files',
+    noSharedFiles: 'No files shared',
+    expires: 'Expires',
+    remove: 'Remove',
+    textChannel: 'Text',
+    textToPhone: 'Text to send to the phone',
+    send: 'Send',
+    autoCopyText: 'Copy received text to the clipboard automatically',
+    noTexts: 'No text sent or received yet',
+    fromPhone: 'From phone',
+    fromPC: 'From PC',
+    copy: 'Copy',
+    searchHistory: 'Search by file name or device',
+    compressedOnly: 'Compressed files only',
+    fileMissing: '(file missing)',
+    compressing: 'Compressing images',
+    compressRunning: 'compressing',
+    uploadRules: 'Upload rules',
+    noUploadRules: 'No rules (everything goes to the save location)',
+    defaultSaveDir: 'save location',
+    addRule: 'Add rule',
+    edit: 'Edit',
+    save: 'Save',
+    cancel: 'Cancel',
+    ruleName: 'Name',
+    ruleConditions: 'Conditions (all must match; leave empty to ignore)',
+    ruleExtensions: 'Extensions',
+    ruleMimeTypes: 'File types',
+    ruleNameGlob: 'File name',
+    ruleNameRegex: 'Regex',
+    ruleSizeMB: 'Size (MB)',
+    ruleDevice: 'Device',
+    ruleActions: 'Actions',
+    ruleSaveDir: 'Save to',
+    ruleCompressDefault: 'Use setting',
+    ruleCompressOn: 'Compress',
+    ruleCompressOff: 'Do not compress',
+    ruleRename: 'Rename to',
+    ruleRenameHint: 'Leave empty to use the File names setting',
+    testRules: 'Try the rules',
+    test: 'Try',
+    noRuleMatched: 'No rule matched',
+    compressQueued: 'waiting',
   },
 } as const;
 
@@ -2,18 +2,92 @@
 // This file is automatically generated. DO NOT EDIT
 import {main} from '../models';
 
+export function AddSharedFiles(arg1:Array<string>):Promise<Array<main.SharedFile>>;
+
+export function CopyTextToClipboard(arg1:string):Promise<void>;
+
+export function DeleteUploadRule(arg1:string):Promise<void>;
+
+export function ForgetDevice(arg1:string):Promise<void>;
+
+export function GetApprovedDevices():Promise<Array<main.ApprovedDevice>>;
+
+export function GetAutoCopyText():Promise<boolean>;
+
+export function GetCompressQueue():Promise<Array<main.CompressJob>>;
+
 export function GetCompressSettings():Promise<Record<string, any>>;
 
+export function GetConflictPolicy():Promise<string>;
+
+export function GetDuplicateMode():Promise<string>;
+
+export function GetFileTypeLists():Promise<main.FileTypeLists>;
+
+export function GetFolderTemplate():Promise<string>;
+
 export function GetLang():Promise<string>;
 
+export function GetRenameTemplate():Promise<string>;
+
 export function GetSaveDir():Promise<string>;
 
 export function GetServerInfo():Promise<Record<string, any>>;
 
+export function GetSessions():Promise<Array<main.Session>>;
+
+export function GetSharedFiles():Promise<Array<main.SharedFile>>;
+
+export function GetTextHistory():Promise<Array<main.TextMessage>>;
+
 export function GetUploadHistory():Promise<Array<main.UploadRecord>>;
 
+export function GetUploadRules():Promise<Array<main.UploadRule>>;
+
+export function MoveUploadRule(arg1:string,arg2:number):Promise<void>;
+
+export function PreviewRenameTemplate(arg1:string,arg2:string):Promise<string>;
+
+export function QueryUploadHistory(arg1:main.HistoryQuery):Promise<main.HistoryPage>;
+
+export function RemoveSharedFile(arg1:string):Promise<void>;
+
+export function RespondDeviceApproval(arg1:string,arg2:boolean):Promise<void>;
+
+export function RevokeAllSessions():Promise<void>;
+
+export function RevokeSession(arg1:string):Promise<void>;
+
+export function SaveUploadRule(arg1:main.UploadRule):Promise<main.UploadRule>;
+
 export function SelectSaveDir():Promise<string>;
 
-export function SetCompressSettings(arg1:boolean,arg2:number,arg3:boolean):Promise<void>;
+export function SendTextToPhone(arg1:string):Promise<void>;
+
+export function SetAutoCopyText(arg1:boolean):Promise<void>;
+
+export function SetCompressSettings(arg1:boolean,arg2:number,arg3:boolean,arg4:number):Promise<void>;
+
+export function SetConflictPolicy(arg1:string):Promise<void>;
+
+export function SetDuplicateMode(arg1:string):Promise<void>;
+
+export function SetFileTypeLists(arg1:Array<string>,arg2:Array<string>):Promise<void>;
+
+export function SetFolderTemplate(arg1:string):Promise<void>;
+
+export function SetHEICSettings(arg1:string,arg2:boolean):Promise<void>;
 
 export function SetLang(arg1:string):Promise<void>;
+
+export function SetOutputFormat(arg1:string,arg2:boolean):Promise<void>;
+
+export function SetPrivacyMode(arg1:boolean):Promise<void>;
+
+export function SetRenameTemplate(arg1:string):Promise<void>;
+
+export function SetUseHTTPS(arg1:boolean):Promise<void>;
+
+export function ShareFiles():Promise<Array<main.SharedFile>>;
+
+export function TestUploadRules(arg1:string,arg2:number,arg3:string):Promise<main.RuleMatch>;
@@ -2,14 +2,62 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddSharedFiles(arg1) {
+  return window['go']['main']['App']['AddSharedFiles'](arg1);
+}
+
+export function CopyTextToClipboard(arg1) {
+  return window['go']['main']['App']['CopyTextToClipboard'](arg1);
+}
+
+export function DeleteUploadRule(arg1) {
+  return window['go']['main']['App']['DeleteUploadRule'](arg1);
+}
+
+export function ForgetDevice(arg1) {
+  return window['go']['main']['App']['ForgetDevice'](arg1);
+}
+
+export function GetApprovedDevices() {
+  return window['go']['main']['App']['GetApprovedDevices']();
+}
+
+export function GetAutoCopyText() {
+  return window['go']['main']['App']['GetAutoCopyText']();
+}
+
+export function GetCompressQueue() {
+  return window['go']['main']['App']['GetCompressQueue']();
+}
+
 export function GetCompressSettings() {
   return window['go']['main']['App']['GetCompressSettings']();
 }
 
+export function GetConflictPolicy() {
+  return window['go']['main']['App']['GetConflictPolicy']();
+}
+
+export function GetDuplicateMode() {
+  return window['go']['main']['App']['GetDuplicateMode']();
+}
+
+export function GetFileTypeLists() {
+  return window['go']['main']['App']['GetFileTypeLists']();
+}
+
+export function GetFolderTemplate() {
+  return window['go']['main']['App']['GetFolderTemplate']();
+}
+
 export function GetLang() {
   return window['go']['main']['App']['GetLang']();
 }
 
+export function GetRenameTemplate() {
+  return window['go']['main']['App']['GetRenameTemplate']();
+}
+
 export function GetSaveDir() {
   return window['go']['main']['App']['GetSaveDir']();
 }
@@ -18,18 +66,118 @@ export function GetServerInfo() {
   return window['go']['main']['App']['GetServerInfo']();
 }
 
+export function GetSessions() {
+  return window['go']['main']['App']['GetSessions']();
+}
+
+export function GetSharedFiles() {
+  return window['go']['main']['App']['GetSharedFiles']();
+}
+
+export function GetTextHistory() {
+  return window['go']['main']['App']['GetTextHistory']();
+}
+
 export function GetUploadHistory() {
   return window['go']['main']['App']['GetUploadHistory']();
 }
 
+export function GetUploadRules() {
+  return window['go']['main']['App']['GetUploadRules']();
+}
+
+export function MoveUploadRule(arg1, arg2) {
+  return window['go']['main']['App']['MoveUploadRule'](arg1, arg2);
+}
+
+export function PreviewRenameTemplate(arg1, arg2) {
+  return window['go']['main']['App']['PreviewRenameTemplate'](arg1, arg2);
+}
+
+export function QueryUploadHistory(arg1) {
+  return window['go']['main']['App']['QueryUploadHistory'](arg1);
+}
+
+export function RemoveSharedFile(arg1) {
+  return window['go']['main']['App']['RemoveSharedFile'](arg1);
+}
+
+export function RespondDeviceApproval(arg1, arg2) {
+  return window['go']['main']['App']['RespondDeviceApproval'](arg1, arg2);
+}
+
+export function RevokeAllSessions() {
+  return window['go']['main']['App']['RevokeAllSessions']();
+}
+
+export function RevokeSession(arg1) {
+  return window['go']['main']['App']['RevokeSession'](arg1);
+}
+
+export function SaveUploadRule(arg1) {
+  return window['go']['main']['App']['SaveUploadRule'](arg1);
+}
+
 export function SelectSaveDir() {
   return window['go']['main']['App']['SelectSaveDir']();
 }
 
-export function SetCompressSettings(arg1, arg2, arg3) {
-  return window['go']['main']['App']['SetCompressSettings'](arg1, arg2, arg3);
+export function SendTextToPhone(arg1) {
+  return window['go']['main']['App']['SendTextToPhone'](arg1);
+}
+
+export function SetAutoCopyText(arg1) {
+  return window['go']['main']['App']['SetAutoCopyText'](arg1);
+}
+
+export function SetCompressSettings(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['SetCompressSettings'](arg1, arg2, arg3, arg4);
+}
+
+export function SetConflictPolicy(arg1) {
+  return window['go']['main']['App']['SetConflictPolicy'](arg1);
+}
+
+export function SetDuplicateMode(arg1) {
+  return window['go']['main']['App']['SetDuplicateMode'](arg1);
+}
+
+export function SetFileTypeLists(arg1, arg2) {
+  return window['go']['main']['App']['SetFileTypeLists'](arg1, arg2);
+}
+
+export function SetFolderTemplate(arg1) {
+  return window['go']['main']['App']['SetFolderTemplate'](arg1);
+}
+
+export function SetHEICSettings(arg1, arg2) {
+  return window['go']['main']['App']['SetHEICSettings'](arg1, arg2);
 }
 
 export function SetLang(arg1) {
   return window['go']['main']['App']['SetLang'](arg1);
 }
+
+export function SetOutputFormat(arg1, arg2) {
+  return window['go']['main']['App']['SetOutputFormat'](arg1, arg2);
+}
+
+export function SetPrivacyMode(arg1) {
+  return window['go']['main']['App']['SetPrivacyMode'](arg1);
+}
+
+export function SetRenameTemplate(arg1) {
+  return window['go']['main']['App']['SetRenameTemplate'](arg1);
+}
+
+export function SetUseHTTPS(arg1) {
+  return window['go']['main']['App']['SetUseHTTPS'](arg1);
+}
+
+export function ShareFiles() {
+  return window['go']['main']['App']['ShareFiles']();
+}
+
+export function TestUploadRules(arg1, arg2, arg3) {
+  return window['go']['main']['App']['TestUploadRules'](arg1, arg2, arg3);
+}
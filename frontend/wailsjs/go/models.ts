@@ -1,5 +1,225 @@
 export namespace main {
 	
+	export class ApprovedDevice {
+	    id: string;
+	    name: string;
+	    approvedAt: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ApprovedDevice(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.approvedAt = source["approvedAt"];
+	    }
+	}
+	export class CompressJob {
+	    id: number;
+	    fileName: string;
+	    device?: string;
+	    state: string;
+	    pending: number;
+	    record?: UploadRecord;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new CompressJob(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.fileName = source["fileName"];
+	        this.device = source["device"];
+	        this.state = source["state"];
+	        this.pending = source["pending"];
+	        this.record = this.convertValues(source["record"], UploadRecord);
+	        this.error = source["error"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class FileTypeLists {
+	    allow: string[];
+	    deny: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new FileTypeLists(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.allow = source["allow"];
+	        this.deny = source["deny"];
+	    }
+	}
+	export class HistoryPage {
+	    records: UploadRecord[];
+	    total: number;
+	    page: number;
+	    pageSize: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HistoryPage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.records = this.convertValues(source["records"], UploadRecord);
+	        this.total = source["total"];
+	        this.page = source["page"];
+	        this.pageSize = source["pageSize"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class HistoryQuery {
+	    search: string;
+	    device: string;
+	    from: string;
+	    to: string;
+	    minSize: number;
+	    maxSize: number;
+	    compressedOnly: boolean;
+	    page: number;
+	    pageSize: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HistoryQuery(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.search = source["search"];
+	        this.device = source["device"];
+	        this.from = source["from"];
+	        this.to = source["to"];
+	        this.minSize = source["minSize"];
+	        this.maxSize = source["maxSize"];
+	        this.compressedOnly = source["compressedOnly"];
+	        this.page = source["page"];
+	        this.pageSize = source["pageSize"];
+	    }
+	}
+	export class RuleMatch {
+	    ruleId?: string;
+	    ruleName?: string;
+	    saveDir: string;
+	    fileName: string;
+	    compress: boolean;
+	    mimeType?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RuleMatch(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ruleId = source["ruleId"];
+	        this.ruleName = source["ruleName"];
+	        this.saveDir = source["saveDir"];
+	        this.fileName = source["fileName"];
+	        this.compress = source["compress"];
+	        this.mimeType = source["mimeType"];
+	    }
+	}
+	export class Session {
+	    id: string;
+	    userAgent: string;
+	    address: string;
+	    created: string;
+	    expires: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Session(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.userAgent = source["userAgent"];
+	        this.address = source["address"];
+	        this.created = source["created"];
+	        this.expires = source["expires"];
+	    }
+	}
+	export class SharedFile {
+	    id: string;
+	    name: string;
+	    size: number;
+	    path: string;
+	    addedAt: string;
+	    expiresAt: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SharedFile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.size = source["size"];
+	        this.path = source["path"];
+	        this.addedAt = source["addedAt"];
+	        this.expiresAt = source["expiresAt"];
+	    }
+	}
+	export class TextMessage {
+	    id: number;
+	    text: string;
+	    from: string;
+	    device?: string;
+	    timestamp: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TextMessage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.text = source["text"];
+	        this.from = source["from"];
+	        this.device = source["device"];
+	        this.timestamp = source["timestamp"];
+	    }
+	}
 	export class UploadRecord {
 	    fileName: string;
 	    size: number;
@@ -7,6 +227,17 @@ export namespace main {
 	    savePath: string;
 	    compressed?: boolean;
 	    originalSize?: number;
+	    device?: string;
+	    exists: boolean;
+	    metadataStripped?: boolean;
+	    status?: string;
+	    sha256?: string;
+	    duplicateOf?: string;
+	    conflictAction?: string;
+	    folder?: string;
+	    rule?: string;
+	    contentType?: string;
+	    extMismatch?: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new UploadRecord(source);
@@ -20,6 +251,53 @@ export namespace main {
 	        this.savePath = source["savePath"];
 	        this.compressed = source["compressed"];
 	        this.originalSize = source["originalSize"];
+	        this.device = source["device"];
+	        this.exists = source["exists"];
+	        this.metadataStripped = source["metadataStripped"];
+	        this.status = source["status"];
+	        this.sha256 = source["sha256"];
+	        this.duplicateOf = source["duplicateOf"];
+	        this.conflictAction = source["conflictAction"];
+	        this.folder = source["folder"];
+	        this.rule = source["rule"];
+	        this.contentType = source["contentType"];
+	        this.extMismatch = source["extMismatch"];
+	    }
+	}
+	export class UploadRule {
+	    id: string;
+	    name: string;
+	    enabled: boolean;
+	    extensions?: string[];
+	    mimeTypes?: string[];
+	    nameGlob?: string;
+	    nameRegex?: string;
+	    minSize?: number;
+	    maxSize?: number;
+	    device?: string;
+	    saveDir?: string;
+	    compress?: string;
+	    renameTemplate?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new UploadRule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.enabled = source["enabled"];
+	        this.extensions = source["extensions"];
+	        this.mimeTypes = source["mimeTypes"];
+	        this.nameGlob = source["nameGlob"];
+	        this.nameRegex = source["nameRegex"];
+	        this.minSize = source["minSize"];
+	        this.maxSize = source["maxSize"];
+	        this.device = source["device"];
+	        this.saveDir = source["saveDir"];
+	        this.compress = source["compress"];
+	        this.renameTemplate = source["renameTemplate"];
 	    }
 	}
 
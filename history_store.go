@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// historyFileName is the append-only upload log in the config directory
+const historyFileName = "history.jsonl"
+
+// defaultHistoryPageSize is used when a query does not set a page size
+const defaultHistoryPageSize = 50
+
+// HistoryQuery filters and pages the persistent upload history
+type HistoryQuery struct {
+	Search         string `json:"search"`         // substring of the file name or device
+	Device         string `json:"device"`         // substring of the device
+	From           string `json:"from"`           // "2006-01-02", inclusive
+	To             string `json:"to"`             // "2006-01-02", inclusive
+	MinSize        int64  `json:"minSize"`        // bytes, 0 = no limit
+	MaxSize        int64  `json:"maxSize"`        // bytes, 0 = no limit
+	CompressedOnly bool   `json:"compressedOnly"` // only files that were compressed
+	Page           int    `json:"page"`           // 0-based
+	PageSize       int    `json:"pageSize"`
+}
+
+// HistoryPage is one page of history query results
+type HistoryPage struct {
+	Records  []UploadRecord `json:"records"`
+	Total    int            `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+}
+
+// historyStore persists every upload record as one JSON line
+type historyStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// newHistoryStore creates a store backed by the history file in the config directory
+func newHistoryStore() *historyStore {
+	return &historyStore{path: filepath.Join(getConfigDir(), historyFileName)}
+}
+
+// Append writes a record to the end of the history file
+func (h *historyStore) Append(record UploadRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// readAll returns every stored record, oldest first. Unreadable lines are skipped.
+func (h *historyStore) readAll() []UploadRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.Open(h.path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var records []UploadRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var record UploadRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Failed to read upload history: %v", err)
+	}
+	return records
+}
+
+// Recent returns the newest n records, newest first
+func (h *historyStore) Recent(n int) []UploadRecord {
+	records := h.readAll()
+	result := make([]UploadRecord, 0, n)
+	for i := len(records) - 1; i >= 0 && len(result) < n; i-- {
+		result = append(result, records[i])
+	}
+	return result
+}
+
+// Query returns the records matching q, newest first. Exists is filled in
+// for the returned page only.
+func (h *historyStore) Query(q HistoryQuery) HistoryPage {
+	if q.PageSize <= 0 {
+		q.PageSize = defaultHistoryPageSize
+	}
+	if q.Page < 0 {
+		q.Page = 0
+	}
+
+	records := h.readAll()
+	var matched []UploadRecord
+	for i := len(records) - 1; i >= 0; i-- {
+		if q.matches(&records[i]) {
+			matched = append(matched, records[i])
+		}
+	}
+
+	page := HistoryPage{
+		Records:  []UploadRecord{},
+		Total:    len(matched),
+		Page:     q.Page,
+		PageSize: q.PageSize,
+	}
+
+	start := q.Page * q.PageSize
+	if start >= len(matched) {
+		return page
+	}
+	end := start + q.PageSize
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	page.Records = matched[start:end]
+	for i := range page.Records {
+		page.Records[i].Exists = fileExists(page.Records[i].SavePath)
+	}
+	return page
+}
+
+// matches reports whether a record passes every filter in the query
+func (q *HistoryQuery) matches(r *UploadRecord) bool {
+	if q.Search != "" {
+		s := strings.ToLower(q.Search)
+		if !strings.Contains(strings.ToLower(r.FileName), s) && !strings.Contains(strings.ToLower(r.Device), s) {
+			return false
+		}
+	}
+	if q.Device != "" && !strings.Contains(strings.ToLower(r.Device), strings.ToLower(q.Device)) {
+		return false
+	}
+	// Timestamps are "2006-01-02 15:04:05", so the date prefix compares as a string
+	if q.From != "" && r.Timestamp[:min(10, len(r.Timestamp))] < q.From {
+		return false
+	}
+	if q.To != "" && r.Timestamp[:min(10, len(r.Timestamp))] > q.To {
+		return false
+	}
+	if q.MinSize > 0 && r.Size < q.MinSize {
+		return false
+	}
+	if q.MaxSize > 0 && r.Size > q.MaxSize {
+		return false
+	}
+	if q.CompressedOnly && !r.Compressed {
+		return false
+	}
+	return true
+}
+
+// fileExists reports whether a regular file exists at path
+func fileExists(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && !st.IsDir()
+}
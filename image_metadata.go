@@ -0,0 +1,914 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// exifHeader prefixes the TIFF data in a JPEG APP1 segment
+const exifHeader = "Exif\x00\x00"
+
+// xmpHeader prefixes the XMP packet in a JPEG APP1 segment
+const xmpHeader = "http://ns.adobe.com/xap/1.0/\x00"
+
+// xmpExtensionHeader prefixes each part of an extended XMP packet, which
+// holds what does not fit in the main one, in JPEG APP1 segments
+const xmpExtensionHeader = "http://ns.adobe.com/xmp/extension/\x00"
+
+// xmpContentType is the content type of XMP items in HEIF files
+const xmpContentType = "application/rdf+xml"
+
+// iccHeader prefixes each chunk of an ICC profile in JPEG APP2 segments
+const iccHeader = "ICC_PROFILE\x00"
+
+// pngSignature starts every PNG file
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngXMPKeyword is the iTXt keyword that marks an XMP packet in PNG
+const pngXMPKeyword = "XML:com.adobe.xmp"
+
+// maxJPEGSegment is the largest payload a JPEG marker segment can carry
+const maxJPEGSegment = 0xFFFF - 2
+
+// maxHEIFMetaRead is the most readHEIFExif reads for the meta box and for
+// the Exif item each. Both are a few KB in photos from phones.
+const maxHEIFMetaRead = 4 << 20
+
+// imageMetadata is the metadata carried over when an image is re-encoded
+type imageMetadata struct {
+	exif []byte // TIFF data, without the "Exif\0\0" header
+	xmp  []byte // XMP packet
+	icc  []byte // ICC color profile
+}
+
+// empty reports whether there is no metadata to carry over
+func (m imageMetadata) empty() bool {
+	return len(m.exif) == 0 && len(m.xmp) == 0 && len(m.icc) == 0
+}
+
+// readImageMetadata extracts EXIF, XMP and ICC data from an encoded image.
+// Unknown formats and damaged files yield empty metadata.
+func readImageMetadata(data []byte, ext string) imageMetadata {
+	switch ext {
+	case ".jpg", ".jpeg":
+		return readJPEGMetadata(data)
+	case ".png":
+		return readPNGMetadata(data)
+	case ".webp":
+		return readWebPMetadata(data)
+	case ".heic", ".heif":
+		return imageMetadata{exif: heifExif(data)}
+	}
+	return imageMetadata{}
+}
+
+// readJPEGMetadata collects APP1 (EXIF, XMP) and APP2 (ICC) segments
+func readJPEGMetadata(data []byte) imageMetadata {
+	var m imageMetadata
+	var iccChunks [][]byte
+
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return m
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			break
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte
+			pos++
+			continue
+		}
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			pos += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			// Start of scan: metadata segments come before it
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		payload := data[pos+4 : pos+2+length]
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(payload, []byte(exifHeader)) && m.exif == nil:
+			m.exif = payload[len(exifHeader):]
+		case marker == 0xE1 && bytes.HasPrefix(payload, []byte(xmpHeader)) && m.xmp == nil:
+			m.xmp = payload[len(xmpHeader):]
+		case marker == 0xE2 && bytes.HasPrefix(payload, []byte(iccHeader)) && len(payload) > len(iccHeader)+2:
+			iccChunks = append(iccChunks, payload[len(iccHeader):])
+		}
+		pos += 2 + length
+	}
+
+	m.icc = joinICCChunks(iccChunks)
+	return m
+}
+
+// joinICCChunks reassembles an ICC profile split over APP2 segments. Each
+// chunk starts with its 1-based sequence number and the chunk count.
+func joinICCChunks(chunks [][]byte) []byte {
+	if len(chunks) == 0 {
+		return nil
+	}
+	count := int(chunks[0][1])
+	ordered := make([][]byte, count)
+	for _, c := range chunks {
+		seq := int(c[0])
+		if seq < 1 || seq > count || int(c[1]) != count {
+			return nil
+		}
+		ordered[seq-1] = c[2:]
+	}
+	var icc []byte
+	for _, c := range ordered {
+		if c == nil {
+			return nil
+		}
+		icc = append(icc, c...)
+	}
+	return icc
+}
+
+// readPNGMetadata collects eXIf, iCCP and XMP iTXt chunks
+func readPNGMetadata(data []byte) imageMetadata {
+	var m imageMetadata
+
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return m
+	}
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		typ := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			break
+		}
+		body := data[pos+8 : pos+8+length]
+
+		switch typ {
+		case "eXIf":
+			m.exif = body
+		case "iCCP":
+			// profile name, NUL, compression method, zlib data
+			if i := bytes.IndexByte(body, 0); i >= 0 && i+2 <= len(body) {
+				m.icc = inflate(body[i+2:])
+			}
+		case "iTXt":
+			if xmp := pngXMP(body); xmp != nil {
+				m.xmp = xmp
+			}
+		case "IDAT", "IEND":
+			return m
+		}
+		pos += 12 + length
+	}
+	return m
+}
+
+// pngXMP returns the text of an iTXt chunk if it holds an XMP packet
+func pngXMP(body []byte) []byte {
+	prefix := pngXMPKeyword + "\x00"
+	if !bytes.HasPrefix(body, []byte(prefix)) || len(body) < len(prefix)+2 {
+		return nil
+	}
+	compressed := body[len(prefix)] == 1
+	rest := body[len(prefix)+2:]
+	// Skip language tag and translated keyword
+	for i := 0; i < 2; i++ {
+		j := bytes.IndexByte(rest, 0)
+		if j < 0 {
+			return nil
+		}
+		rest = rest[j+1:]
+	}
+	if compressed {
+		return inflate(rest)
+	}
+	return rest
+}
+
+// inflate decompresses zlib data, returning nil on error
+func inflate(data []byte) []byte {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// readWebPMetadata collects the EXIF, XMP and ICCP chunks of a WebP file
+func readWebPMetadata(data []byte) imageMetadata {
+	var m imageMetadata
+
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return m
+	}
+	pos := 12
+	for pos+8 <= len(data) {
+		typ := string(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if length < 0 || pos+8+length > len(data) {
+			break
+		}
+		body := data[pos+8 : pos+8+length]
+
+		switch typ {
+		case "EXIF":
+			// Some encoders keep the JPEG "Exif\0\0" header
+			m.exif = bytes.TrimPrefix(body, []byte(exifHeader))
+		case "XMP ":
+			m.xmp = body
+		case "ICCP":
+			m.icc = body
+		}
+		// Chunks are padded to an even size
+		pos += 8 + length + length&1
+	}
+	return m
+}
+
+// writeJPEG returns jpegData with the metadata inserted as APP1/APP2
+// segments right after the SOI marker. Parts too large for a segment are dropped.
+func (m imageMetadata) writeJPEG(jpegData []byte) []byte {
+	if len(jpegData) < 2 {
+		return jpegData
+	}
+
+	var segs bytes.Buffer
+	writeSegment := func(marker byte, parts ...[]byte) {
+		n := 0
+		for _, p := range parts {
+			n += len(p)
+		}
+		if n > maxJPEGSegment {
+			return
+		}
+		segs.Write([]byte{0xFF, marker, byte((n + 2) >> 8), byte(n + 2)})
+		for _, p := range parts {
+			segs.Write(p)
+		}
+	}
+
+	if len(m.exif) > 0 {
+		writeSegment(0xE1, []byte(exifHeader), m.exif)
+	}
+	if len(m.xmp) > 0 {
+		writeSegment(0xE1, []byte(xmpHeader), m.xmp)
+	}
+	if len(m.icc) > 0 {
+		// Split the profile over as many APP2 segments as needed
+		chunkSize := maxJPEGSegment - len(iccHeader) - 2
+		count := (len(m.icc) + chunkSize - 1) / chunkSize
+		if count <= 255 {
+			for i := 0; i < count; i++ {
+				chunk := m.icc[i*chunkSize : min((i+1)*chunkSize, len(m.icc))]
+				writeSegment(0xE2, []byte(iccHeader), []byte{byte(i + 1), byte(count)}, chunk)
+			}
+		}
+	}
+	if segs.Len() == 0 {
+		return jpegData
+	}
+
+	out := make([]byte, 0, len(jpegData)+segs.Len())
+	out = append(out, jpegData[:2]...)
+	out = append(out, segs.Bytes()...)
+	out = append(out, jpegData[2:]...)
+	return out
+}
+
+// writeWebP returns webpData with ICCP, EXIF and XMP chunks added. Simple
+// (VP8/VP8L only) files are converted to the extended format, which needs
+// the canvas size and whether the image has transparency.
+func (m imageMetadata) writeWebP(webpData []byte, width, height int, hasAlpha bool) []byte {
+	if m.empty() {
+		return webpData
+	}
+	if len(webpData) < 12 || string(webpData[:4]) != "RIFF" || string(webpData[8:12]) != "WEBP" {
+		return webpData
+	}
+
+	var vp8x []byte
+	var image bytes.Buffer
+	pos := 12
+	for pos+8 <= len(webpData) {
+		typ := string(webpData[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(webpData[pos+4:]))
+		end := min(pos+8+length+length&1, len(webpData))
+		if typ == "VP8X" {
+			vp8x = bytes.Clone(webpData[pos+8 : end])
+		} else {
+			image.Write(webpData[pos:end])
+		}
+		pos = end
+	}
+
+	if len(vp8x) < 10 {
+		// Flags (4 bytes) and canvas width and height minus one (24 bits each)
+		vp8x = make([]byte, 10)
+		vp8x[4], vp8x[5], vp8x[6] = byte(width-1), byte((width-1)>>8), byte((width-1)>>16)
+		vp8x[7], vp8x[8], vp8x[9] = byte(height-1), byte((height-1)>>8), byte((height-1)>>16)
+		if hasAlpha {
+			vp8x[0] |= 0x10
+		}
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	if len(m.icc) > 0 {
+		vp8x[0] |= 0x20
+	}
+	if len(m.exif) > 0 {
+		vp8x[0] |= 0x08
+	}
+	if len(m.xmp) > 0 {
+		vp8x[0] |= 0x04
+	}
+	writeRIFFChunk(&body, "VP8X", vp8x)
+	if len(m.icc) > 0 {
+		writeRIFFChunk(&body, "ICCP", m.icc)
+	}
+	body.Write(image.Bytes())
+	if len(m.exif) > 0 {
+		writeRIFFChunk(&body, "EXIF", m.exif)
+	}
+	if len(m.xmp) > 0 {
+		writeRIFFChunk(&body, "XMP ", m.xmp)
+	}
+
+	out := make([]byte, 0, 8+body.Len())
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(body.Len()))
+	return append(out, body.Bytes()...)
+}
+
+// writeRIFFChunk writes a RIFF chunk, padded to an even size
+func writeRIFFChunk(w *bytes.Buffer, typ string, data []byte) {
+	w.WriteString(typ)
+	binary.Write(w, binary.LittleEndian, uint32(len(data)))
+	w.Write(data)
+	if len(data)%2 == 1 {
+		w.WriteByte(0)
+	}
+}
+
+// writePNG returns pngData with iCCP, eXIf and XMP iTXt chunks inserted
+// right after IHDR, where PNG requires the color profile to be
+func (m imageMetadata) writePNG(pngData []byte) []byte {
+	// Signature (8) + IHDR chunk (4 + 4 + 13 + 4)
+	const ihdrEnd = 8 + 25
+	if len(pngData) < ihdrEnd || string(pngData[12:16]) != "IHDR" {
+		return pngData
+	}
+
+	var chunks bytes.Buffer
+	if len(m.icc) > 0 {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(m.icc)
+		zw.Close()
+		writePNGChunk(&chunks, "iCCP", []byte("ICC Profile\x00\x00"), z.Bytes())
+	}
+	if len(m.exif) > 0 {
+		writePNGChunk(&chunks, "eXIf", m.exif)
+	}
+	if len(m.xmp) > 0 {
+		// keyword, NUL, uncompressed, method, empty language, empty translation
+		writePNGChunk(&chunks, "iTXt", []byte(pngXMPKeyword+"\x00\x00\x00\x00\x00"), m.xmp)
+	}
+	if chunks.Len() == 0 {
+		return pngData
+	}
+
+	out := make([]byte, 0, len(pngData)+chunks.Len())
+	out = append(out, pngData[:ihdrEnd]...)
+	out = append(out, chunks.Bytes()...)
+	out = append(out, pngData[ihdrEnd:]...)
+	return out
+}
+
+// writePNGChunk writes a PNG chunk with its length and CRC
+func writePNGChunk(w *bytes.Buffer, typ string, parts ...[]byte) {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	binary.Write(w, binary.BigEndian, uint32(n))
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	w.WriteString(typ)
+	for _, p := range parts {
+		crc.Write(p)
+		w.Write(p)
+	}
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// tagOrientation is the EXIF Orientation tag in IFD0
+const tagOrientation = 0x0112
+
+// tiffByteOrder returns the byte order of TIFF data, or nil if it is not TIFF
+func tiffByteOrder(tiff []byte) binary.ByteOrder {
+	if len(tiff) < 8 {
+		return nil
+	}
+	switch string(tiff[:2]) {
+	case "II":
+		return binary.LittleEndian
+	case "MM":
+		return binary.BigEndian
+	}
+	return nil
+}
+
+// ifd0Entry returns the offset of the IFD0 entry for tag in tiff, or -1
+func ifd0Entry(tiff []byte, order binary.ByteOrder, tag uint16) int {
+	return ifdEntry(tiff, order, int(order.Uint32(tiff[4:8])), tag)
+}
+
+// ifdEntry returns the offset of the entry for tag in the IFD at offset ifd, or -1
+func ifdEntry(tiff []byte, order binary.ByteOrder, ifd int, tag uint16) int {
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return -1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == tag {
+			return entry
+		}
+	}
+	return -1
+}
+
+// exifOrientation returns the EXIF Orientation (1-8), or 1 when it is
+// missing or invalid
+func exifOrientation(tiff []byte) int {
+	order := tiffByteOrder(tiff)
+	if order == nil {
+		return 1
+	}
+	entry := ifd0Entry(tiff, order, tagOrientation)
+	if entry < 0 {
+		return 1
+	}
+	v := int(order.Uint16(tiff[entry+8:]))
+	if v < 1 || v > 8 {
+		return 1
+	}
+	return v
+}
+
+// resetExifOrientation returns a copy of tiff with the Orientation tag set
+// to 1 (normal), for images whose pixels have already been rotated
+func resetExifOrientation(tiff []byte) []byte {
+	order := tiffByteOrder(tiff)
+	if order == nil {
+		return tiff
+	}
+
+	out := bytes.Clone(tiff)
+	if entry := ifd0Entry(out, order, tagOrientation); entry >= 0 {
+		order.PutUint16(out[entry+8:], 1)
+	}
+	return out
+}
+
+// heifBox is one ISOBMFF box: its type and payload
+type heifBox struct {
+	typ  string
+	body []byte
+}
+
+// readHEIFBoxes splits data into consecutive ISOBMFF boxes
+func readHEIFBoxes(data []byte) []heifBox {
+	var boxes []heifBox
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return boxes
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return boxes
+		}
+		boxes = append(boxes, heifBox{typ: typ, body: data[header:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// findHEIFBox returns the payload of the first box of the given type
+func findHEIFBox(boxes []heifBox, typ string) []byte {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b.body
+		}
+	}
+	return nil
+}
+
+// heifReader reads big-endian fields of variable width from a box payload
+type heifReader struct {
+	data []byte
+	pos  int
+	err  bool
+}
+
+// uint reads an n-byte unsigned integer (n = 0, 1, 2, 4 or 8)
+func (r *heifReader) uint(n int) uint64 {
+	if r.err || r.pos+n > len(r.data) {
+		r.err = true
+		return 0
+	}
+	var v uint64
+	for _, b := range r.data[r.pos : r.pos+n] {
+		v = v<<8 | uint64(b)
+	}
+	r.pos += n
+	return v
+}
+
+// heifExif returns the TIFF data of the Exif item in a HEIC/HEIF file, or nil
+func heifExif(data []byte) []byte {
+	return exifItemTIFF(bytes.Join(heifExifItem(data), nil))
+}
+
+// heifExifItem returns the extents of the Exif item in a HEIC/HEIF file as
+// slices of data, so callers can edit it in place
+func heifExifItem(data []byte) [][]byte {
+	return heifItem(data, heifExifItemID)
+}
+
+// heifItem returns the extents of the item that find picks from the iinf
+// box of a HEIC/HEIF file, as slices of data
+func heifItem(data []byte, find func(iinf []byte) (uint32, bool)) [][]byte {
+	meta := findHEIFBox(readHEIFBoxes(data), "meta")
+	if len(meta) < 4 {
+		return nil
+	}
+	// meta is a full box: skip version and flags
+	children := readHEIFBoxes(meta[4:])
+
+	id, ok := find(findHEIFBox(children, "iinf"))
+	if !ok {
+		return nil
+	}
+	return heifItemExtents(data, findHEIFBox(children, "iloc"), findHEIFBox(children, "idat"), id)
+}
+
+// exifItemTIFF returns the TIFF data inside a HEIF Exif item, which starts
+// with the offset of the TIFF header ("Exif\0\0" usually sits in between)
+func exifItemTIFF(payload []byte) []byte {
+	if len(payload) < 4 {
+		return nil
+	}
+	offset := 4 + uint64(binary.BigEndian.Uint32(payload))
+	if offset >= uint64(len(payload)) {
+		return nil
+	}
+	tiff := payload[offset:]
+	if tiffByteOrder(tiff) == nil {
+		return nil
+	}
+	return tiff
+}
+
+// heifExifItemID finds the ID of the item of type "Exif" in an iinf box
+func heifExifItemID(iinf []byte) (uint32, bool) {
+	return heifItemID(iinf, func(itemType string, _ []byte) bool {
+		return itemType == "Exif"
+	})
+}
+
+// heifXMPItemID finds the ID of the XMP item in an iinf box: an item of type
+// "mime" whose content type, after the item name, is xmpContentType
+func heifXMPItemID(iinf []byte) (uint32, bool) {
+	return heifItemID(iinf, func(itemType string, rest []byte) bool {
+		if itemType != "mime" {
+			return false
+		}
+		_, contentType, ok := bytes.Cut(rest, []byte{0})
+		if !ok {
+			return false
+		}
+		contentType, _, _ = bytes.Cut(contentType, []byte{0})
+		return string(contentType) == xmpContentType
+	})
+}
+
+// heifItemID finds the ID of the first item in an iinf box that match
+// accepts, given its item type and the fields that follow it
+func heifItemID(iinf []byte, match func(itemType string, rest []byte) bool) (uint32, bool) {
+	if len(iinf) < 4 {
+		return 0, false
+	}
+	r := &heifReader{data: iinf}
+	version := r.uint(1)
+	r.uint(3)
+	if version == 0 {
+		r.uint(2)
+	} else {
+		r.uint(4)
+	}
+	if r.err {
+		return 0, false
+	}
+
+	for _, infe := range readHEIFBoxes(iinf[r.pos:]) {
+		if infe.typ != "infe" {
+			continue
+		}
+		ir := &heifReader{data: infe.body}
+		v := ir.uint(1)
+		ir.uint(3)
+		if v < 2 {
+			continue
+		}
+		var id uint64
+		if v == 2 {
+			id = ir.uint(2)
+		} else {
+			id = ir.uint(4)
+		}
+		ir.uint(2) // item_protection_index
+		if ir.err || ir.pos+4 > len(ir.data) {
+			continue
+		}
+		if match(string(ir.data[ir.pos:ir.pos+4]), ir.data[ir.pos+4:]) {
+			return uint32(id), true
+		}
+	}
+	return 0, false
+}
+
+// heifExtent is where part of a HEIF item is stored: at off in the file
+// (construction method 0) or in idat (1). Length 0 runs to the end.
+type heifExtent struct {
+	method uint64
+	off    uint64
+	length uint64
+}
+
+// heifItemExtents returns the extents of an item listed in iloc as slices of
+// file or idat
+func heifItemExtents(file, iloc, idat []byte, itemID uint32) [][]byte {
+	var extents [][]byte
+	for _, e := range heifItemLocation(iloc, itemID) {
+		src := file
+		if e.method == 1 {
+			src = idat
+		}
+		if e.off > uint64(len(src)) {
+			return nil
+		}
+		length := e.length
+		if length == 0 {
+			length = uint64(len(src)) - e.off
+		}
+		if length > uint64(len(src))-e.off {
+			return nil
+		}
+		extents = append(extents, src[e.off:e.off+length])
+	}
+	return extents
+}
+
+// heifItemLocation returns where the extents of an item listed in iloc are
+// stored. Items stored in the file (construction method 0) and in idat (1)
+// are supported.
+func heifItemLocation(iloc []byte, itemID uint32) []heifExtent {
+	r := &heifReader{data: iloc}
+	version := r.uint(1)
+	r.uint(3)
+	sizes := r.uint(2)
+	offsetSize := int(sizes >> 12 & 0xF)
+	lengthSize := int(sizes >> 8 & 0xF)
+	baseOffsetSize := int(sizes >> 4 & 0xF)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0xF)
+	}
+
+	var itemCount uint64
+	if version < 2 {
+		itemCount = r.uint(2)
+	} else {
+		itemCount = r.uint(4)
+	}
+
+	for i := uint64(0); i < itemCount && !r.err; i++ {
+		var id uint64
+		if version < 2 {
+			id = r.uint(2)
+		} else {
+			id = r.uint(4)
+		}
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = r.uint(2) & 0xF
+		}
+		r.uint(2) // data_reference_index
+		base := r.uint(baseOffsetSize)
+		extentCount := r.uint(2)
+
+		var extents []heifExtent
+		for e := uint64(0); e < extentCount && !r.err; e++ {
+			r.uint(indexSize)
+			off := base + r.uint(offsetSize)
+			length := r.uint(lengthSize)
+			if uint32(id) != itemID {
+				continue
+			}
+			if method > 1 {
+				return nil
+			}
+			extents = append(extents, heifExtent{method: method, off: off, length: length})
+		}
+		if uint32(id) == itemID && !r.err {
+			return extents
+		}
+	}
+	return nil
+}
+
+// readJPEGExif reads the EXIF TIFF data of a JPEG from its marker segments,
+// stopping at the image data, so only the start of the file is read
+func readJPEGExif(r io.Reader) []byte {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return nil
+	}
+	for {
+		if b, err := br.ReadByte(); err != nil || b != 0xFF {
+			return nil
+		}
+		marker, err := br.ReadByte()
+		for err == nil && marker == 0xFF {
+			// Fill bytes
+			marker, err = br.ReadByte()
+		}
+		if err != nil || marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue
+		}
+
+		var size [2]byte
+		if _, err := io.ReadFull(br, size[:]); err != nil {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(size[:])) - 2
+		if length < 0 {
+			return nil
+		}
+		if marker != 0xE1 {
+			if _, err := br.Discard(length); err != nil {
+				return nil
+			}
+			continue
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return nil
+		}
+		if bytes.HasPrefix(payload, []byte(exifHeader)) {
+			return payload[len(exifHeader):]
+		}
+	}
+}
+
+// readHEIFExif reads the EXIF TIFF data of a HEIC/HEIF file of the given size
+// from its meta box and Exif item, without reading the image data
+func readHEIFExif(f io.ReaderAt, size int64) []byte {
+	meta, metaOff := readHEIFMeta(f, size)
+	item := heifFileItem(meta, metaOff, size, heifExifItemID)
+	return exifItemTIFF(readFileRanges(f, item, maxHEIFMetaRead))
+}
+
+// readFileRanges reads runs of a file one after another. Returns nil if they
+// add up to more than limit bytes or cannot be read.
+func readFileRanges(f io.ReaderAt, ranges []fileRange, limit int64) []byte {
+	var data []byte
+	for _, r := range ranges {
+		if int64(len(data))+r.length > limit {
+			return nil
+		}
+		buf := make([]byte, r.length)
+		if _, err := f.ReadAt(buf, r.off); err != nil {
+			return nil
+		}
+		data = append(data, buf...)
+	}
+	return data
+}
+
+// readHEIFMeta reads the body of the top-level meta box of a HEIC/HEIF file
+// and returns it with its offset in the file
+func readHEIFMeta(f io.ReaderAt, size int64) ([]byte, int64) {
+	for pos := int64(0); pos+8 <= size; {
+		var hdr [16]byte
+		if _, err := f.ReadAt(hdr[:8], pos); err != nil {
+			return nil, 0
+		}
+		boxSize := int64(binary.BigEndian.Uint32(hdr[:4]))
+		header := int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = size - pos
+		case 1:
+			if _, err := f.ReadAt(hdr[8:16], pos+8); err != nil {
+				return nil, 0
+			}
+			boxSize = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			header = 16
+		}
+		if boxSize < header || boxSize > size-pos {
+			return nil, 0
+		}
+		if string(hdr[4:8]) == "meta" {
+			if boxSize-header > maxHEIFMetaRead {
+				return nil, 0
+			}
+			meta := make([]byte, boxSize-header)
+			if _, err := f.ReadAt(meta, pos+header); err != nil {
+				return nil, 0
+			}
+			return meta, pos + header
+		}
+		pos += boxSize
+	}
+	return nil, 0
+}
+
+// fileRange is a run of bytes in a file
+type fileRange struct {
+	off, length int64
+}
+
+// heifFileItem returns where in a HEIC/HEIF file of the given size the item
+// found by find is stored. meta is the body of its meta box, read at metaOff.
+func heifFileItem(meta []byte, metaOff, size int64, find func(iinf []byte) (uint32, bool)) []fileRange {
+	if len(meta) < 4 {
+		return nil
+	}
+	// meta is a full box: skip version and flags
+	children := readHEIFBoxes(meta[4:])
+	itemID, ok := find(findHEIFBox(children, "iinf"))
+	if !ok {
+		return nil
+	}
+	// idat is a slice of meta, so its offset in meta follows from the capacities
+	idat := findHEIFBox(children, "idat")
+	idatOff := metaOff + int64(cap(meta)-cap(idat))
+
+	var ranges []fileRange
+	for _, e := range heifItemLocation(findHEIFBox(children, "iloc"), itemID) {
+		start, end := int64(0), size
+		if e.method == 1 {
+			start, end = idatOff, idatOff+int64(len(idat))
+		}
+		avail := uint64(end - start)
+		if e.off > avail {
+			return nil
+		}
+		length := e.length
+		if length == 0 {
+			length = avail - e.off
+		}
+		if length > avail-e.off {
+			return nil
+		}
+		ranges = append(ranges, fileRange{off: start + int64(e.off), length: int64(length)})
+	}
+	return ranges
+}
@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"image/color"
 	"image/jpeg"
 	"image/png"
-	"io"
 	"log"
 	"path/filepath"
 	"strings"
+	"sync"
 
+	"github.com/gen2brain/avif"
+	"github.com/gen2brain/heic"
+	webpenc "github.com/gen2brain/webp"
+	"golang.org/x/image/draw"
 	"golang.org/x/image/webp"
 )
 
@@ -21,6 +26,86 @@ type CompressResult struct {
 	DidCompress  bool
 	OriginalSize int64
 	NewSize      int64
+
+	// Pixel dimensions before and after resizing (0 when not decoded)
+	OriginalWidth  int
+	OriginalHeight int
+	Width          int
+	Height         int
+}
+
+// CompressOptions controls how CompressImage re-encodes an image
+type CompressOptions struct {
+	Quality           int    // JPEG/WebP/AVIF quality, 1-100
+	MaxDimension      int    // maximum long edge in pixels, 0 = no resizing
+	Format            string // one of the outputFormat constants
+	PNGToWebPLossless bool   // save PNG as lossless WebP in keep and WebP modes
+}
+
+// maxCompressPixels is the largest image that is decoded for compression
+// (about 400MB as RGBA)
+const maxCompressPixels = 100_000_000
+
+// decodePixelBudget is how many pixels may be decoded at the same time, by
+// all compression workers together. A decode holds a few full-size copies
+// for a while (decoded, rotated, resized), about 12 bytes per pixel, so this
+// keeps compression around 1.5GB whatever the CPU count. It must be at least
+// maxCompressPixels.
+const decodePixelBudget = 128_000_000
+
+// decodeBudget hands out decodePixelBudget to CompressImage calls
+var decodeBudget = newPixelBudget(decodePixelBudget)
+
+// pixelBudget is a semaphore weighted by pixel count
+type pixelBudget struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	free int64
+	size int64
+}
+
+// newPixelBudget returns a budget of size pixels
+func newPixelBudget(size int64) *pixelBudget {
+	b := &pixelBudget{free: size, size: size}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire waits until n pixels are free and takes them. Returns what was
+// taken, to be given back with release.
+func (b *pixelBudget) acquire(n int64) int64 {
+	n = min(max(n, 1), b.size)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.free < n {
+		b.cond.Wait()
+	}
+	b.free -= n
+	return n
+}
+
+// release gives back pixels taken with acquire
+func (b *pixelBudget) release(n int64) {
+	b.mu.Lock()
+	b.free += n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// Output formats for compressed images
+const (
+	outputFormatKeep = "keep" // same format as the source where an encoder exists
+	outputFormatJPEG = "jpeg"
+	outputFormatWebP = "webp"
+	outputFormatAVIF = "avif"
+)
+
+// validOutputFormats lists the accepted CompressOptions.Format values
+var validOutputFormats = map[string]bool{
+	outputFormatKeep: true,
+	outputFormatJPEG: true,
+	outputFormatWebP: true,
+	outputFormatAVIF: true,
 }
 
 // compressibleExts lists extensions that can be compressed
@@ -29,6 +114,20 @@ var compressibleExts = map[string]bool{
 	".jpeg": true,
 	".png":  true,
 	".webp": true,
+	".heic": true,
+	".heif": true,
+}
+
+// HEIC output settings
+const (
+	heicOutputJPEG = "jpeg" // convert HEIC to JPEG when compressing
+	heicOutputKeep = "keep" // save HEIC files as they are
+)
+
+// IsHEIC checks if a filename has a HEIC/HEIF extension
+func IsHEIC(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".heic" || ext == ".heif"
 }
 
 // IsCompressibleImage checks if a filename has a compressible image extension
@@ -37,15 +136,16 @@ func IsCompressibleImage(filename string) bool {
 	return compressibleExts[ext]
 }
 
-// CompressImage compresses image data based on the file extension and quality setting.
+// CompressImage compresses image data based on the file extension and options.
 // Returns the compressed data or an error. On error, caller should fall back to original.
-func CompressImage(data []byte, filename string, quality int) (*CompressResult, error) {
+func CompressImage(data []byte, filename string, opts CompressOptions) (*CompressResult, error) {
 	ext := strings.ToLower(filepath.Ext(filename))
 
 	if !compressibleExts[ext] {
 		return &CompressResult{Data: data, Extension: ext, DidCompress: false, OriginalSize: int64(len(data))}, nil
 	}
 
+	quality := opts.Quality
 	if quality < 1 || quality > 100 {
 		quality = 80
 	}
@@ -53,6 +153,18 @@ func CompressImage(data []byte, filename string, quality int) (*CompressResult,
 	reader := bytes.NewReader(data)
 	originalSize := int64(len(data))
 
+	// Check the size first so a huge image cannot exhaust memory when decoded,
+	// and wait until there is room to decode it. Images whose size cannot be
+	// read are counted as the largest allowed.
+	pixels := int64(maxCompressPixels)
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		if cfg.Width*cfg.Height > maxCompressPixels {
+			return nil, fmt.Errorf("image too large to compress (%dx%d)", cfg.Width, cfg.Height)
+		}
+		pixels = int64(cfg.Width) * int64(cfg.Height)
+	}
+	defer decodeBudget.release(decodeBudget.acquire(pixels))
+
 	var img image.Image
 	var err error
 
@@ -63,6 +175,9 @@ func CompressImage(data []byte, filename string, quality int) (*CompressResult,
 		img, err = png.Decode(reader)
 	case ".webp":
 		img, err = webp.Decode(reader)
+	case ".heic", ".heif":
+		// The decoder applies the EXIF orientation to the pixels
+		img, err = heic.Decode(reader)
 	default:
 		return &CompressResult{Data: data, Extension: ext, DidCompress: false, OriginalSize: originalSize}, nil
 	}
@@ -71,59 +186,212 @@ func CompressImage(data []byte, filename string, quality int) (*CompressResult,
 		return nil, fmt.Errorf("failed to decode %s image: %w", ext, err)
 	}
 
+	// Carry over capture date, camera info and color profile
+	meta := readImageMetadata(data, ext)
+	if meta.exif != nil {
+		if !IsHEIC(filename) {
+			// Rotate the pixels so viewers that ignore EXIF show the photo upright.
+			// The HEIC decoder already does this.
+			img = orientImage(img, exifOrientation(meta.exif))
+		}
+		meta.exif = resetExifOrientation(meta.exif)
+	}
+
+	origBounds := img.Bounds()
+	img = resizeToFit(img, opts.MaxDimension)
+	resized := img.Bounds().Size() != origBounds.Size()
+
+	outExt := outputExtension(ext, opts)
+	if outExt == ".avif" && !meta.empty() {
+		// The AVIF encoder cannot attach metadata, so use WebP, which can
+		log.Printf("Saving %s as WebP instead of AVIF to keep its metadata", filename)
+		outExt = ".webp"
+	}
 	var buf bytes.Buffer
-	var outExt string
 
-	switch ext {
-	case ".jpg", ".jpeg":
-		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
-		outExt = ".jpg"
-	case ".webp":
-		// WebP decode is supported but Go stdlib can't encode WebP,
-		// so re-encode as JPEG with the specified quality
-		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
-		outExt = ".jpg"
+	switch outExt {
+	case ".jpg":
+		// JPEG has no transparency, so flatten onto white instead of black
+		err = jpeg.Encode(&buf, flattenAlpha(img), &jpeg.Options{Quality: quality})
 	case ".png":
 		// PNG compression: use BestCompression encoder
 		encoder := &png.Encoder{CompressionLevel: png.BestCompression}
 		err = encoder.Encode(&buf, img)
-		outExt = ".png"
+	case ".webp":
+		err = webpenc.Encode(&buf, img, webpenc.Options{
+			Quality:  quality,
+			Lossless: ext == ".png" && opts.PNGToWebPLossless,
+			Method:   webpenc.DefaultMethod,
+		})
+	case ".avif":
+		err = avif.Encode(&buf, img, avif.Options{
+			Quality:           quality,
+			QualityAlpha:      quality,
+			Speed:             avif.DefaultSpeed,
+			ChromaSubsampling: image.YCbCrSubsampleRatio420,
+		})
 	}
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode image: %w", err)
 	}
 
-	newSize := int64(buf.Len())
+	outData := buf.Bytes()
+	switch outExt {
+	case ".jpg":
+		outData = meta.writeJPEG(outData)
+	case ".png":
+		outData = meta.writePNG(outData)
+	case ".webp":
+		outData = meta.writeWebP(outData, img.Bounds().Dx(), img.Bounds().Dy(), !isOpaque(img))
+	}
+	newSize := int64(len(outData))
 
-	// If compressed is larger, keep original
-	if newSize >= originalSize && ext != ".webp" {
+	// If compressed is larger, keep original (format conversions and resizing always apply)
+	converted := outExt != ext && !(outExt == ".jpg" && ext == ".jpeg")
+	if newSize >= originalSize && !converted && !resized {
 		log.Printf("Compression did not reduce size for %s (%d >= %d), keeping original", filename, newSize, originalSize)
-		return &CompressResult{Data: data, Extension: ext, DidCompress: false, OriginalSize: originalSize, NewSize: originalSize}, nil
+		return &CompressResult{
+			Data:           data,
+			Extension:      ext,
+			DidCompress:    false,
+			OriginalSize:   originalSize,
+			NewSize:        originalSize,
+			OriginalWidth:  origBounds.Dx(),
+			OriginalHeight: origBounds.Dy(),
+			Width:          origBounds.Dx(),
+			Height:         origBounds.Dy(),
+		}, nil
+	}
+
+	if resized {
+		log.Printf("Resized %s from %dx%d to %dx%d", filename, origBounds.Dx(), origBounds.Dy(), img.Bounds().Dx(), img.Bounds().Dy())
 	}
 
 	return &CompressResult{
-		Data:         buf.Bytes(),
-		Extension:    outExt,
-		DidCompress:  true,
-		OriginalSize: originalSize,
-		NewSize:      newSize,
+		Data:           outData,
+		Extension:      outExt,
+		DidCompress:    true,
+		OriginalSize:   originalSize,
+		NewSize:        newSize,
+		OriginalWidth:  origBounds.Dx(),
+		OriginalHeight: origBounds.Dy(),
+		Width:          img.Bounds().Dx(),
+		Height:         img.Bounds().Dy(),
 	}, nil
 }
 
-// CompressImageFromReader reads all data from reader and compresses it.
-// This is a convenience wrapper for the upload handler.
-func CompressImageFromReader(r io.Reader, filename string, quality int) ([]byte, *CompressResult, error) {
-	data, err := io.ReadAll(r)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read image data: %w", err)
+// orientImage rotates and flips img as described by an EXIF Orientation
+// value (1-8) so it displays upright with orientation 1
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
 	}
 
-	result, err := CompressImage(data, filename, quality)
-	if err != nil {
-		// Return original data so caller can fall back
-		return data, nil, err
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		// 5-8 swap width and height
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// outputExtension returns the extension of the format an image is re-encoded to.
+// HEIC always becomes JPEG: the HEIC setting wins over the save format.
+func outputExtension(ext string, opts CompressOptions) string {
+	if ext == ".heic" || ext == ".heif" {
+		return ".jpg"
+	}
+	switch opts.Format {
+	case outputFormatJPEG:
+		return ".jpg"
+	case outputFormatWebP:
+		return ".webp"
+	case outputFormatAVIF:
+		return ".avif"
+	}
+
+	// Keep the source format where there is an encoder for it
+	switch ext {
+	case ".png":
+		if opts.PNGToWebPLossless {
+			return ".webp"
+		}
+		return ".png"
+	case ".webp":
+		return ".webp"
+	}
+	return ".jpg"
+}
+
+// isOpaque reports whether an image has no transparent pixels
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// flattenAlpha draws a transparent image over a white background
+func flattenAlpha(img image.Image) image.Image {
+	if isOpaque(img) {
+		return img
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// resizeToFit downsamples img so its long edge is at most maxDimension,
+// keeping the aspect ratio. Smaller images and maxDimension 0 are left alone.
+func resizeToFit(img image.Image, maxDimension int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxDimension <= 0 || (w <= maxDimension && h <= maxDimension) {
+		return img
+	}
+
+	nw, nh := maxDimension, maxDimension
+	if w >= h {
+		nh = max(1, (h*maxDimension+w/2)/w)
+	} else {
+		nw = max(1, (w*maxDimension+h/2)/h)
 	}
 
-	return data, result, nil
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
 }
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	webpenc "github.com/gen2brain/webp"
+)
+
+func TestOrientImage(t *testing.T) {
+	// 3x2 with the top-left pixel marked; each orientation moves it to a
+	// different corner of the upright image
+	red := color.RGBA{R: 255, A: 255}
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.Set(0, 0, red)
+
+	tests := []struct {
+		orientation   int
+		width, height int
+		x, y          int // where the marked pixel ends up
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.orientation), func(t *testing.T) {
+			got := orientImage(src, tt.orientation)
+			b := got.Bounds()
+			if b.Dx() != tt.width || b.Dy() != tt.height {
+				t.Fatalf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.width, tt.height)
+			}
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					marked := color.RGBAModel.Convert(got.At(x, y)) == red
+					if want := x-b.Min.X == tt.x && y-b.Min.Y == tt.y; marked != want {
+						t.Errorf("pixel (%d,%d) marked = %v, want %v", x, y, marked, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestOrientImageInvalid(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for _, orientation := range []int{0, 9, -1} {
+		if got := orientImage(src, orientation); got != image.Image(src) {
+			t.Errorf("orientation %d: image was changed", orientation)
+		}
+	}
+}
+
+// Quadrant colors of the orientation fixture
+var (
+	quadRed   = color.RGBA{R: 255, A: 255}
+	quadGreen = color.RGBA{G: 255, A: 255}
+	quadBlue  = color.RGBA{B: 255, A: 255}
+	quadWhite = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+)
+
+// orientationFixture returns a 64x32 image with red, green, blue and white
+// quadrants (top-left, top-right, bottom-left, bottom-right). The quadrants
+// are noisy so re-encoding at a lower quality makes the file smaller.
+func orientationFixture() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			c := quadRed
+			switch {
+			case x >= 32 && y >= 16:
+				c = quadWhite
+			case x >= 32:
+				c = quadGreen
+			case y >= 16:
+				c = quadBlue
+			}
+			noise := uint8((x*7 + y*13) % 24)
+			for _, ch := range []*uint8{&c.R, &c.G, &c.B} {
+				if *ch == 0 {
+					*ch = noise
+				} else {
+					*ch -= noise
+				}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// orientationTIFF returns TIFF data holding only an Orientation tag
+func orientationTIFF(orientation int) []byte {
+	le := binary.LittleEndian
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00")
+	tiff = le.AppendUint16(tiff, tagOrientation)
+	tiff = le.AppendUint16(tiff, 3) // SHORT
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, uint32(orientation))
+	return le.AppendUint32(tiff, 0)
+}
+
+// nearestQuadColor returns which fixture color c is closest to
+func nearestQuadColor(c color.Color) color.RGBA {
+	r, g, b, _ := c.RGBA()
+	best, bestDist := quadRed, uint32(1<<32-1)
+	for _, q := range []color.RGBA{quadRed, quadGreen, quadBlue, quadWhite} {
+		d := func(a uint32, b uint8) uint32 {
+			a >>= 8
+			if a > uint32(b) {
+				return a - uint32(b)
+			}
+			return uint32(b) - a
+		}
+		if dist := d(r, q.R) + d(g, q.G) + d(b, q.B); dist < bestDist {
+			best, bestDist = q, dist
+		}
+	}
+	return best
+}
+
+func TestCompressImageOrientation(t *testing.T) {
+	// Quadrant colors of the upright image: top-left, top-right,
+	// bottom-left, bottom-right
+	tests := []struct {
+		orientation   int
+		width, height int
+		quads         [4]color.RGBA
+	}{
+		{1, 64, 32, [4]color.RGBA{quadRed, quadGreen, quadBlue, quadWhite}},
+		{2, 64, 32, [4]color.RGBA{quadGreen, quadRed, quadWhite, quadBlue}},
+		{3, 64, 32, [4]color.RGBA{quadWhite, quadBlue, quadGreen, quadRed}},
+		{4, 64, 32, [4]color.RGBA{quadBlue, quadWhite, quadRed, quadGreen}},
+		{5, 32, 64, [4]color.RGBA{quadRed, quadBlue, quadGreen, quadWhite}},
+		{6, 32, 64, [4]color.RGBA{quadBlue, quadRed, quadWhite, quadGreen}},
+		{7, 32, 64, [4]color.RGBA{quadWhite, quadGreen, quadBlue, quadRed}},
+		{8, 32, 64, [4]color.RGBA{quadGreen, quadWhite, quadRed, quadBlue}},
+	}
+
+	fixture := orientationFixture()
+	encoders := map[string]func(orientation int) ([]byte, error){
+		".jpg": func(orientation int) ([]byte, error) {
+			var buf bytes.Buffer
+			err := jpeg.Encode(&buf, fixture, &jpeg.Options{Quality: 100})
+			return imageMetadata{exif: orientationTIFF(orientation)}.writeJPEG(buf.Bytes()), err
+		},
+		".webp": func(orientation int) ([]byte, error) {
+			var buf bytes.Buffer
+			err := webpenc.Encode(&buf, fixture, webpenc.Options{Quality: 100, Method: webpenc.DefaultMethod})
+			return imageMetadata{exif: orientationTIFF(orientation)}.writeWebP(buf.Bytes(), 64, 32, false), err
+		},
+	}
+
+	for ext, encode := range encoders {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/%d", ext, tt.orientation), func(t *testing.T) {
+				data, err := encode(tt.orientation)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if o := exifOrientation(readImageMetadata(data, ext).exif); o != tt.orientation {
+					t.Fatalf("fixture Orientation = %d", o)
+				}
+				result, err := CompressImage(data, "photo"+ext, CompressOptions{Quality: 60, Format: outputFormatKeep})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !result.DidCompress || result.Extension != ext {
+					t.Fatalf("DidCompress = %v, extension %s", result.DidCompress, result.Extension)
+				}
+
+				img, _, err := image.Decode(bytes.NewReader(result.Data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				b := img.Bounds()
+				if b.Dx() != tt.width || b.Dy() != tt.height {
+					t.Fatalf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.width, tt.height)
+				}
+				centers := [4]image.Point{
+					{b.Dx() / 4, b.Dy() / 4}, {b.Dx() * 3 / 4, b.Dy() / 4},
+					{b.Dx() / 4, b.Dy() * 3 / 4}, {b.Dx() * 3 / 4, b.Dy() * 3 / 4},
+				}
+				for i, p := range centers {
+					if got := nearestQuadColor(img.At(b.Min.X+p.X, b.Min.Y+p.Y)); got != tt.quads[i] {
+						t.Errorf("quadrant %d is %v, want %v", i, got, tt.quads[i])
+					}
+				}
+
+				if o := exifOrientation(readImageMetadata(result.Data, ext).exif); o != 1 {
+					t.Errorf("output Orientation = %d, want 1 or none", o)
+				}
+			})
+		}
+	}
+}
@@ -1,7 +1,10 @@
+//go:build !headless
+
 package main
 
 import (
 	"embed"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -12,6 +15,10 @@ import (
 var assets embed.FS
 
 func main() {
+	if dir := configDirFromArgs(os.Args[1:]); dir != "" {
+		setConfigDir(dir)
+	}
+
 	app := NewApp()
 
 	err := wails.Run(&options.App{
@@ -0,0 +1,83 @@
+//go:build headless
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// main runs the upload server without the Wails GUI. Build with
+// `go build -tags headless`. Uploads go through the same handlers as the
+// desktop app; paired devices are approved without a prompt.
+func main() {
+	saveDir := flag.String("dir", "", "save directory (default: from config)")
+	useHTTPS := flag.Bool("https", false, "serve over HTTPS with a self-signed certificate")
+	configDir := flag.String("config", "", "config directory (default: OS config location)")
+	flag.Parse()
+
+	log.SetOutput(os.Stdout)
+	if *configDir != "" {
+		setConfigDir(*configDir)
+	}
+
+	app := NewApp()
+	app.headless = true
+	// Kept apart from the config so approving a device does not save them
+	app.saveDirOverride = *saveDir
+	app.httpsOverride = *useHTTPS
+
+	if err := os.MkdirAll(app.GetSaveDir(), 0755); err != nil {
+		log.Fatalf("Failed to create save directory: %v", err)
+	}
+
+	// The QR secret and PIN rotate after pairing and the URL follows the LAN
+	// IP, so show the new ones
+	app.fileServer.auth.onChange = func() {
+		printPairingInfo(app)
+	}
+
+	if err := app.fileServer.Start(); err != nil {
+		log.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	log.Printf("Saving files to %s", app.GetSaveDir())
+	printPairingInfo(app)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Printf("Shutting down")
+	if err := app.fileServer.Stop(); err != nil {
+		log.Printf("Failed to stop HTTP server: %v", err)
+	}
+	app.fileServer.compress.Close()
+}
+
+// printPairingInfo prints the upload URL, a QR code for it and the pairing PIN
+func printPairingInfo(app *App) {
+	url := app.fileServer.GetUploadURL()
+	if url == "" {
+		return
+	}
+
+	fmt.Println()
+	if qr, err := qrcode.New(url, qrcode.Medium); err == nil {
+		fmt.Print(qr.ToSmallString(false))
+	} else {
+		log.Printf("Failed to generate QR code: %v", err)
+	}
+	fmt.Printf("Upload URL: %s\n", url)
+	fmt.Printf("Pairing PIN: %s\n", app.fileServer.GetPairingPIN())
+	if fp := app.fileServer.GetCertFingerprint(); fp != "" {
+		fmt.Printf("Certificate SHA-256: %s\n", fp)
+	}
+	fmt.Println()
+}
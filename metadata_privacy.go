@@ -0,0 +1,608 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// EXIF pointer tags in IFD0
+const (
+	tagExifIFD = 0x8769
+	tagGPSIFD  = 0x8825
+)
+
+// maxMetadataChunk is the largest PNG or WebP metadata chunk
+// stripPrivateMetadataFile reads into memory; larger ones are copied as they
+// are
+const maxMetadataChunk = 16 << 20
+
+// maxJPEGHead is the most stripPrivateMetadataFile reads of the marker
+// segments before the first scan of a JPEG
+const maxJPEGHead = 16 << 20
+
+// privateIFD0Tags are removed from IFD0 in privacy mode
+var privateIFD0Tags = map[uint16]bool{
+	tagGPSIFD: true, // GPS location
+	0x013B:    true, // Artist
+	0x013C:    true, // HostComputer
+	0x9C9D:    true, // XPAuthor
+}
+
+// privateExifTags are removed from the Exif sub-IFD in privacy mode
+var privateExifTags = map[uint16]bool{
+	0x927C: true, // MakerNote (may hold serial numbers)
+	0xA420: true, // ImageUniqueID
+	0xA430: true, // CameraOwnerName
+	0xA431: true, // BodySerialNumber
+	0xA435: true, // LensSerialNumber
+}
+
+// tiffTypeSizes is the byte size of each TIFF field type
+var tiffTypeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// stripPrivateMetadata removes GPS and personal EXIF tags and XMP packets
+// from an encoded image without re-encoding the pixels. Returns the new data
+// and whether anything was removed.
+func stripPrivateMetadata(data []byte, ext string) ([]byte, bool) {
+	switch ext {
+	case ".jpg", ".jpeg":
+		return stripJPEGMetadata(data)
+	case ".png":
+		return stripPNGMetadata(data)
+	case ".webp":
+		return stripWebPMetadata(data)
+	case ".heic", ".heif":
+		return stripHEIFMetadata(data)
+	}
+	return data, false
+}
+
+// stripJPEGMetadata cleans the APP1 Exif segment in place and drops APP1 XMP
+// segments, extended XMP included
+func stripJPEGMetadata(data []byte) ([]byte, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data, false
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	stripped := false
+	pos := 2
+	for pos+4 <= len(data) {
+		marker := data[pos+1]
+		if data[pos] != 0xFF || marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		if marker == 0xFF || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8) {
+			// Fill bytes and markers without a length
+			n := 2
+			if marker == 0xFF {
+				n = 1
+			}
+			out = append(out, data[pos:pos+n]...)
+			pos += n
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		seg := data[pos : pos+2+length]
+		payload := seg[4:]
+		pos += 2 + length
+
+		if marker == 0xE1 && (bytes.HasPrefix(payload, []byte(xmpHeader)) || bytes.HasPrefix(payload, []byte(xmpExtensionHeader))) {
+			stripped = true
+			continue
+		}
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte(exifHeader)) {
+			seg = bytes.Clone(seg)
+			if stripPrivateExif(seg[4+len(exifHeader):]) {
+				stripped = true
+			}
+		}
+		out = append(out, seg...)
+	}
+
+	if !stripped {
+		return data, false
+	}
+	return append(out, data[pos:]...), true
+}
+
+// stripPNGMetadata cleans the eXIf chunk and drops XMP iTXt chunks
+func stripPNGMetadata(data []byte) ([]byte, bool) {
+	const sigLen = len(pngSignature)
+	if len(data) < sigLen || !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return data, false
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:sigLen])
+	stripped := false
+	pos := sigLen
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || pos+12+length > len(data) {
+			break
+		}
+		typ := string(data[pos+4 : pos+8])
+		body := data[pos+8 : pos+8+length]
+		chunk := data[pos : pos+12+length]
+		pos += 12 + length
+
+		switch {
+		case typ == "iTXt" && pngXMP(body) != nil:
+			stripped = true
+			continue
+		case typ == "eXIf":
+			body = bytes.Clone(body)
+			if stripPrivateExif(body) {
+				stripped = true
+				writePNGChunk(&out, typ, body)
+				continue
+			}
+		}
+		out.Write(chunk)
+	}
+
+	if !stripped {
+		return data, false
+	}
+	out.Write(data[pos:])
+	return out.Bytes(), true
+}
+
+// stripWebPMetadata cleans the EXIF chunk and drops the XMP chunk
+func stripWebPMetadata(data []byte) ([]byte, bool) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return data, false
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	stripped := false
+	vp8x := -1
+	pos := 12
+	for pos+8 <= len(data) {
+		typ := string(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		padded := length + length&1
+		if length < 0 || pos+8+length > len(data) {
+			break
+		}
+		chunk := data[pos:min(pos+8+padded, len(data))]
+		pos += 8 + padded
+
+		switch typ {
+		case "XMP ":
+			stripped = true
+			continue
+		case "VP8X":
+			vp8x = len(out)
+		case "EXIF":
+			chunk = bytes.Clone(chunk)
+			if stripPrivateExif(bytes.TrimPrefix(chunk[8:8+length], []byte(exifHeader))) {
+				stripped = true
+			}
+		}
+		out = append(out, chunk...)
+	}
+
+	if !stripped {
+		return data, false
+	}
+	if vp8x >= 0 && vp8x+9 <= len(out) {
+		// Clear the "has XMP" flag
+		out[vp8x+8] &^= 0x04
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, true
+}
+
+// stripHEIFMetadata cleans the Exif item of a HEIC/HEIF file and blanks its
+// XMP item, in place. Removed values are zeroed or replaced with spaces, so
+// item offsets stay valid.
+func stripHEIFMetadata(data []byte) ([]byte, bool) {
+	data = bytes.Clone(data)
+	stripped := false
+
+	extents := heifExifItem(data)
+	payload := bytes.Join(extents, nil)
+	if tiff := exifItemTIFF(payload); tiff != nil && stripPrivateExif(tiff) {
+		// Write the cleaned item back over its extents
+		pos := 0
+		for _, e := range extents {
+			pos += copy(e, payload[pos:])
+		}
+		stripped = true
+	}
+
+	// XMP may repeat the location; spaces are how XMP packets are padded
+	for _, e := range heifItem(data, heifXMPItemID) {
+		if len(bytes.TrimLeft(e, " ")) > 0 {
+			copy(e, bytes.Repeat([]byte{' '}, len(e)))
+			stripped = true
+		}
+	}
+	return data, stripped
+}
+
+// stripPrivateMetadataFile does what stripPrivateMetadata does to the file
+// at path, reading only the metadata into memory. JPEG, PNG and WebP files
+// are rewritten through a temp file next to it; HEIF files are cleaned in
+// place.
+func stripPrivateMetadataFile(path, ext string) (bool, error) {
+	switch ext {
+	case ".jpg", ".jpeg":
+		return rewriteFile(path, stripJPEGStream)
+	case ".png":
+		return rewriteFile(path, stripPNGStream)
+	case ".webp":
+		return rewriteFile(path, stripWebPStream)
+	case ".heic", ".heif":
+		return stripHEIFFile(path)
+	}
+	return false, nil
+}
+
+// rewriteFile runs strip from the file at path into a temp file and replaces
+// the file with it if anything was stripped
+func rewriteFile(path string, strip func(dst *os.File, src *bufio.Reader) (bool, error)) (bool, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(path), "strip-*"+tempUploadSuffix)
+	if err != nil {
+		return false, err
+	}
+
+	stripped, err := strip(tmp, bufio.NewReader(src))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	src.Close() // Windows cannot rename over an open file
+	if err == nil && stripped {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil || !stripped {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	return true, nil
+}
+
+// stripJPEGStream strips the marker segments before the first scan and
+// copies the image data after them
+func stripJPEGStream(dst *os.File, src *bufio.Reader) (bool, error) {
+	out, stripped := stripJPEGMetadata(readJPEGHead(src))
+	if !stripped {
+		return false, nil
+	}
+	if _, err := dst.Write(out); err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readJPEGHead reads whole marker segments up to the first scan of a JPEG,
+// at most maxJPEGHead bytes of them
+func readJPEGHead(r *bufio.Reader) []byte {
+	var head []byte
+	for len(head) < maxJPEGHead {
+		b, _ := r.Peek(4)
+		if len(b) < 2 || b[0] != 0xFF {
+			break
+		}
+		n := 2
+		switch marker := b[1]; {
+		case len(head) == 0:
+			if marker != 0xD8 {
+				return nil
+			}
+		case marker == 0xDA || marker == 0xD9:
+			return head
+		case marker == 0xFF:
+			n = 1
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8):
+		case len(b) < 4:
+			return head
+		default:
+			n = 2 + int(binary.BigEndian.Uint16(b[2:]))
+		}
+		seg := make([]byte, n)
+		k, err := io.ReadFull(r, seg)
+		head = append(head, seg[:k]...)
+		if err != nil {
+			break
+		}
+	}
+	return head
+}
+
+// stripPNGStream strips the eXIf and iTXt chunks and copies the others
+func stripPNGStream(dst *os.File, src *bufio.Reader) (bool, error) {
+	if sig, _ := src.Peek(len(pngSignature)); string(sig) != pngSignature {
+		return false, nil
+	}
+	w := bufio.NewWriter(dst)
+	if _, err := io.CopyN(w, src, int64(len(pngSignature))); err != nil {
+		return false, err
+	}
+
+	stripped := false
+	for {
+		hdr, err := src.Peek(8)
+		if err != nil {
+			break
+		}
+		length := int64(binary.BigEndian.Uint32(hdr))
+		if typ := string(hdr[4:8]); (typ != "eXIf" && typ != "iTXt") || length > maxMetadataChunk {
+			if _, err := io.CopyN(w, src, 12+length); err == io.EOF {
+				break
+			} else if err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		chunk := make([]byte, 12+length)
+		n, err := io.ReadFull(src, chunk)
+		if err != nil {
+			w.Write(chunk[:n])
+			break
+		}
+		// Strip the chunk as a PNG of its own
+		out, ok := stripPNGMetadata(append([]byte(pngSignature), chunk...))
+		stripped = stripped || ok
+		w.Write(out[len(pngSignature):])
+	}
+
+	if !stripped {
+		return false, nil
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return false, err
+	}
+	return true, w.Flush()
+}
+
+// stripWebPStream strips the EXIF and XMP chunks, copies the others and then
+// sets the RIFF size
+func stripWebPStream(dst *os.File, src *bufio.Reader) (bool, error) {
+	if hdr, _ := src.Peek(12); len(hdr) < 12 || string(hdr[:4]) != "RIFF" || string(hdr[8:12]) != "WEBP" {
+		return false, nil
+	}
+	w := bufio.NewWriter(dst)
+	written, err := io.CopyN(w, src, 12)
+	if err != nil {
+		return false, err
+	}
+
+	stripped := false
+	for {
+		hdr, err := src.Peek(8)
+		if err != nil {
+			break
+		}
+		typ := string(hdr[:4])
+		length := int64(binary.LittleEndian.Uint32(hdr[4:]))
+		size := 8 + length + length&1
+		if (typ != "XMP " && typ != "EXIF" && typ != "VP8X") || size > maxMetadataChunk {
+			n, err := io.CopyN(w, src, size)
+			written += n
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		chunk := make([]byte, size)
+		n, _ := io.ReadFull(src, chunk)
+		if int64(n) < 8+length {
+			// Truncated: keep what is there, as stripWebPMetadata does
+			w.Write(chunk[:n])
+			written += int64(n)
+			break
+		}
+		chunk = chunk[:n]
+		switch typ {
+		case "XMP ":
+			stripped = true
+			continue
+		case "VP8X":
+			if length > 0 {
+				// Clear the "has XMP" flag; only kept if something is stripped
+				chunk[8] &^= 0x04
+			}
+		case "EXIF":
+			if stripPrivateExif(bytes.TrimPrefix(chunk[8:8+length], []byte(exifHeader))) {
+				stripped = true
+			}
+		}
+		w.Write(chunk)
+		written += int64(n)
+	}
+
+	if !stripped {
+		return false, nil
+	}
+	n, err := io.Copy(w, src)
+	if err != nil {
+		return false, err
+	}
+	if err := w.Flush(); err != nil {
+		return false, err
+	}
+	riffSize := binary.LittleEndian.AppendUint32(nil, uint32(written+n-8))
+	if _, err := dst.WriteAt(riffSize, 4); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// stripHEIFFile cleans the Exif item and blanks the XMP item of a HEIC/HEIF
+// file in place, like stripHEIFMetadata
+func stripHEIFFile(path string) (bool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	meta, metaOff := readHEIFMeta(f, info.Size())
+	stripped := false
+
+	exif := heifFileItem(meta, metaOff, info.Size(), heifExifItemID)
+	payload := readFileRanges(f, exif, maxHEIFMetaRead)
+	if tiff := exifItemTIFF(payload); tiff != nil && stripPrivateExif(tiff) {
+		// Write the cleaned item back over its extents
+		for _, r := range exif {
+			if _, err := f.WriteAt(payload[:r.length], r.off); err != nil {
+				return false, err
+			}
+			payload = payload[r.length:]
+		}
+		stripped = true
+	}
+
+	for _, r := range heifFileItem(meta, metaOff, info.Size(), heifXMPItemID) {
+		blanked, err := blankFileRange(f, r)
+		if err != nil {
+			return false, err
+		}
+		stripped = stripped || blanked
+	}
+	if err := f.Close(); err != nil {
+		return false, err
+	}
+	return stripped, nil
+}
+
+// blankFileRange fills a run of a file with spaces, unless it holds only
+// spaces already
+func blankFileRange(f *os.File, r fileRange) (bool, error) {
+	buf := make([]byte, min(r.length, 64<<10))
+	spaces := bytes.Repeat([]byte{' '}, len(buf))
+	blanked := false
+	for off, end := r.off, r.off+r.length; off < end; off += int64(len(buf)) {
+		buf = buf[:min(int64(cap(buf)), end-off)]
+		if _, err := f.ReadAt(buf, off); err != nil {
+			return false, err
+		}
+		if len(bytes.TrimLeft(buf, " ")) == 0 {
+			continue
+		}
+		if _, err := f.WriteAt(spaces[:len(buf)], off); err != nil {
+			return false, err
+		}
+		blanked = true
+	}
+	return blanked, nil
+}
+
+// stripPrivateExif removes GPS and personal tags from TIFF data in place.
+// Entries are taken out of their IFD and their values zeroed, so the size and
+// layout of the data do not change.
+func stripPrivateExif(tiff []byte) bool {
+	order := tiffByteOrder(tiff)
+	if order == nil {
+		return false
+	}
+	ifd0 := int(order.Uint32(tiff[4:8]))
+
+	stripped := removeIFDEntries(tiff, order, ifd0, privateIFD0Tags)
+	if entry := ifd0Entry(tiff, order, tagExifIFD); entry >= 0 {
+		exifIFD := int(order.Uint32(tiff[entry+8:]))
+		if removeIFDEntries(tiff, order, exifIFD, privateExifTags) {
+			stripped = true
+		}
+	}
+	return stripped
+}
+
+// removeIFDEntries deletes the entries with the given tags from the IFD at
+// offset ifd, zeroing their values. The GPS IFD is zeroed entirely.
+func removeIFDEntries(tiff []byte, order binary.ByteOrder, ifd int, tags map[uint16]bool) bool {
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return false
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	end := ifd + 2 + count*12 // start of the next-IFD offset
+	if end+4 > len(tiff) {
+		return false
+	}
+
+	kept := 0
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		tag := order.Uint16(tiff[entry:])
+		if tags[tag] {
+			if tag == tagGPSIFD {
+				zeroIFD(tiff, order, int(order.Uint32(tiff[entry+8:])))
+			}
+			zeroIFDValue(tiff, order, entry)
+			continue
+		}
+		if kept != i {
+			copy(tiff[ifd+2+kept*12:], tiff[entry:entry+12])
+		}
+		kept++
+	}
+	if kept == count {
+		return false
+	}
+
+	// Move the next-IFD offset up and clear the freed entries
+	newEnd := ifd + 2 + kept*12
+	copy(tiff[newEnd:newEnd+4], tiff[end:end+4])
+	clear(tiff[newEnd+4 : end+4])
+	order.PutUint16(tiff[ifd:], uint16(kept))
+	return true
+}
+
+// zeroIFD zeroes an IFD and every value it points to
+func zeroIFD(tiff []byte, order binary.ByteOrder, ifd int) {
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	end := ifd + 2 + count*12 + 4
+	if end > len(tiff) {
+		return
+	}
+	for i := 0; i < count; i++ {
+		zeroIFDValue(tiff, order, ifd+2+i*12)
+	}
+	clear(tiff[ifd:end])
+}
+
+// zeroIFDValue zeroes the value of an IFD entry stored outside the entry
+func zeroIFDValue(tiff []byte, order binary.ByteOrder, entry int) {
+	size := tiffTypeSizes[order.Uint16(tiff[entry+2:])] * int(order.Uint32(tiff[entry+4:]))
+	if size <= 4 {
+		// Stored inline; removing the entry is enough
+		return
+	}
+	off := int(order.Uint32(tiff[entry+8:]))
+	if off < 8 || off > len(tiff) || size > len(tiff)-off {
+		return
+	}
+	clear(tiff[off : off+size])
+}
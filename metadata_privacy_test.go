@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	webpenc "github.com/gen2brain/webp"
+)
+
+// testXMP is an XMP packet with a location in it
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:Description exif:GPSLatitude="35,41.0N"/></x:xmpmeta>`
+
+// testPrivateTIFF returns little-endian TIFF data with a camera make, an
+// artist and a GPS IFD
+func testPrivateTIFF() []byte {
+	le := binary.LittleEndian
+	entry := func(b []byte, tag, typ uint16, count, value uint32) []byte {
+		b = le.AppendUint16(b, tag)
+		b = le.AppendUint16(b, typ)
+		b = le.AppendUint32(b, count)
+		return le.AppendUint32(b, value)
+	}
+
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = le.AppendUint16(tiff, 3)
+	tiff = entry(tiff, 0x010F, 2, 4, le.Uint32([]byte("Cam\x00"))) // Make
+	tiff = entry(tiff, 0x013B, 2, 11, 50)                          // Artist
+	tiff = entry(tiff, tagGPSIFD, 4, 1, 62)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = append(tiff, "Jane Smith\x00\x00"...)
+
+	// GPS IFD at 62 with GPSLatitude stored at 80
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = entry(tiff, 0x0002, 5, 3, 80)
+	tiff = le.AppendUint32(tiff, 0)
+	for _, v := range []uint32{35, 1, 41, 1, 7, 1} {
+		tiff = le.AppendUint32(tiff, v)
+	}
+	return tiff
+}
+
+// checkPrivateTIFF fails the test if tiff still holds the artist or GPS
+// data of testPrivateTIFF, or lost the camera make
+func checkPrivateTIFF(t *testing.T, tiff []byte) {
+	t.Helper()
+	order := tiffByteOrder(tiff)
+	if order == nil {
+		t.Fatal("EXIF is no longer valid TIFF data")
+	}
+	if ifd0Entry(tiff, order, tagGPSIFD) >= 0 || ifd0Entry(tiff, order, 0x013B) >= 0 {
+		t.Error("GPS or Artist entry was kept")
+	}
+	if ifd0Entry(tiff, order, 0x010F) < 0 {
+		t.Error("Make entry was removed")
+	}
+	if bytes.Contains(tiff, []byte("Jane Smith")) {
+		t.Error("Artist value was kept")
+	}
+	if bytes.Contains(tiff, binary.LittleEndian.AppendUint32([]byte{35, 0, 0, 0}, 1)) {
+		t.Error("GPS value was kept")
+	}
+}
+
+// testImage returns a small opaque image
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
+// testJPEG returns a JPEG with private EXIF data, XMP and extended XMP
+func testJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := imageMetadata{exif: testPrivateTIFF(), xmp: []byte(testXMP)}.writeJPEG(buf.Bytes())
+
+	// Add an extended XMP segment after SOI
+	ext := append([]byte(xmpExtensionHeader), testXMP...)
+	seg := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(ext)+2))
+	return append(append(append([]byte{0xFF, 0xD8}, seg...), ext...), data[2:]...)
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	data := testJPEG(t)
+	out, stripped := stripPrivateMetadata(data, ".jpg")
+	if !stripped {
+		t.Fatal("nothing was stripped")
+	}
+	if bytes.Contains(out, []byte("GPSLatitude")) {
+		t.Error("XMP was kept")
+	}
+	checkPrivateTIFF(t, readImageMetadata(out, ".jpg").exif)
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("result does not decode: %v", err)
+	}
+
+	// Nothing left to strip
+	if again, stripped := stripPrivateMetadata(out, ".jpg"); stripped || !bytes.Equal(again, out) {
+		t.Error("clean JPEG was changed")
+	}
+}
+
+// testPNG returns a PNG with private EXIF data and XMP
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	return imageMetadata{exif: testPrivateTIFF(), xmp: []byte(testXMP)}.writePNG(buf.Bytes())
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	data := testPNG(t)
+	out, stripped := stripPrivateMetadata(data, ".png")
+	if !stripped {
+		t.Fatal("nothing was stripped")
+	}
+	if bytes.Contains(out, []byte("GPSLatitude")) {
+		t.Error("XMP was kept")
+	}
+	checkPrivateTIFF(t, readImageMetadata(out, ".png").exif)
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("result does not decode: %v", err)
+	}
+}
+
+// testWebP returns a WebP with private EXIF data and XMP
+func testWebP(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := webpenc.Encode(&buf, testImage(), webpenc.Options{Quality: 80, Method: webpenc.DefaultMethod}); err != nil {
+		t.Fatal(err)
+	}
+	return imageMetadata{exif: testPrivateTIFF(), xmp: []byte(testXMP)}.writeWebP(buf.Bytes(), 4, 4, false)
+}
+
+func TestStripWebPMetadata(t *testing.T) {
+	data := testWebP(t)
+	out, stripped := stripPrivateMetadata(data, ".webp")
+	if !stripped {
+		t.Fatal("nothing was stripped")
+	}
+	if bytes.Contains(out, []byte("GPSLatitude")) {
+		t.Error("XMP was kept")
+	}
+	if got := binary.LittleEndian.Uint32(out[4:8]); int(got) != len(out)-8 {
+		t.Errorf("RIFF size = %d, want %d", got, len(out)-8)
+	}
+	checkPrivateTIFF(t, readImageMetadata(out, ".webp").exif)
+	if _, err := webpenc.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("result does not decode: %v", err)
+	}
+}
+
+// testHEIF returns a minimal HEIF file with an Exif item and an XMP item in
+// mdat. With idat, the Exif item is stored in the meta box instead.
+func testHEIF(tiff []byte, idat bool) []byte {
+	be := binary.BigEndian
+	box := func(typ string, parts ...[]byte) []byte {
+		body := bytes.Join(parts, nil)
+		return append(be.AppendUint32(nil, uint32(8+len(body))), append([]byte(typ), body...)...)
+	}
+	infe := func(id uint16, itemType, rest string) []byte {
+		b := be.AppendUint16([]byte{2, 0, 0, 0}, id)
+		b = be.AppendUint16(b, 0)
+		return box("infe", b, []byte(itemType+"\x00"+rest))
+	}
+
+	exif := append([]byte{0, 0, 0, 0}, tiff...)
+	xmp := []byte(testXMP)
+	build := func(exifOff, xmpOff uint32) []byte {
+		iinf := box("iinf", []byte{0, 0, 0, 0, 0, 2},
+			infe(1, "Exif", ""),
+			infe(2, "mime", xmpContentType+"\x00"))
+		// Version 1 adds the construction method
+		iloc := []byte{1, 0, 0, 0, 0x44, 0x00, 0, 2}
+		for _, item := range []struct {
+			id, method uint16
+			off, len   uint32
+		}{{1, 0, exifOff, uint32(len(exif))}, {2, 0, xmpOff, uint32(len(xmp))}} {
+			if item.id == 1 && idat {
+				item.method, item.off = 1, 0
+			}
+			iloc = be.AppendUint16(iloc, item.id)
+			iloc = be.AppendUint16(iloc, item.method)
+			iloc = append(iloc, 0, 0, 0, 1)
+			iloc = be.AppendUint32(iloc, item.off)
+			iloc = be.AppendUint32(iloc, item.len)
+		}
+		meta := [][]byte{{0, 0, 0, 0}, iinf, box("iloc", iloc)}
+		mdat := [][]byte{exif, xmp}
+		if idat {
+			meta, mdat = append(meta, box("idat", exif)), mdat[1:]
+		}
+		head := append(box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic")), box("meta", meta...)...)
+		return append(head, box("mdat", mdat...)...)
+	}
+
+	// Build once to learn where the items in mdat start
+	items := uint32(len(xmp))
+	if !idat {
+		items += uint32(len(exif))
+	}
+	mdat := uint32(len(build(0, 0))) - items
+	if idat {
+		return build(0, mdat)
+	}
+	return build(mdat, mdat+uint32(len(exif)))
+}
+
+func TestStripHEIFMetadata(t *testing.T) {
+	data := testHEIF(testPrivateTIFF(), false)
+
+	out, stripped := stripPrivateMetadata(data, ".heic")
+	if !stripped {
+		t.Fatal("nothing was stripped")
+	}
+	if len(out) != len(data) {
+		t.Fatalf("size changed from %d to %d", len(data), len(out))
+	}
+	items := len(data) - 4 - len(testPrivateTIFF()) - len(testXMP) // start of the Exif item
+	if !bytes.Equal(out[:items], data[:items]) {
+		t.Error("boxes outside the items were changed")
+	}
+	if !bytes.HasSuffix(out, bytes.Repeat([]byte{' '}, len(testXMP))) {
+		t.Error("XMP item was not blanked")
+	}
+	checkPrivateTIFF(t, exifItemTIFF(bytes.Join(heifExifItem(out), nil)))
+
+	if again, stripped := stripPrivateMetadata(out, ".heic"); stripped || !bytes.Equal(again, out) {
+		t.Error("clean HEIF was changed")
+	}
+}
+
+func TestStripPrivateMetadataUnknown(t *testing.T) {
+	data := []byte("not an image")
+	for _, ext := range []string{".jpg", ".png", ".webp", ".heic", ".gif"} {
+		if out, stripped := stripPrivateMetadata(data, ext); stripped || !bytes.Equal(out, data) {
+			t.Errorf("%s: data was changed", ext)
+		}
+	}
+}
+
+func TestStripPrivateMetadataFile(t *testing.T) {
+	// Stripping on disk must give the same bytes as stripping in memory
+	tests := map[string][]byte{
+		"photo.jpg":  testJPEG(t),
+		"photo.png":  testPNG(t),
+		"photo.webp": testWebP(t),
+		"photo.heic": testHEIF(testPrivateTIFF(), false),
+		"idat.heic":  testHEIF(testPrivateTIFF(), true),
+		"notes.jpg":  []byte("not an image"),
+		"notes.txt":  []byte("plain text"),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			ext := filepath.Ext(name)
+			want, wantStripped := stripPrivateMetadata(data, ext)
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			stripped, err := stripPrivateMetadataFile(path, ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stripped != wantStripped || !bytes.Equal(got, want) {
+				t.Errorf("stripped = %v, want %v; file matches stripPrivateMetadata: %v", stripped, wantStripped, bytes.Equal(got, want))
+			}
+			if ext == ".heic" {
+				checkPrivateTIFF(t, readHEIFExif(bytes.NewReader(got), int64(len(got))))
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("temp file left behind: %d files", len(entries))
+			}
+		})
+	}
+}
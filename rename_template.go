@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// renameTokens are the placeholders accepted in a rename template. The
+// extension is kept when the template does not use {ext}.
+var renameTokens = map[string]bool{
+	"{date}":     true, // date taken, as in date folders: 20060102
+	"{time}":     true, // time taken: 150405
+	"{device}":   true, // sending device
+	"{original}": true, // file name without the extension
+	"{counter}":  true, // next free number in the folder: 0001
+	"{ext}":      true, // extension without the dot
+	"{hash8}":    true, // first 8 hex digits of the SHA-256
+}
+
+// renameCounterToken is replaced by the counter after the other tokens
+const renameCounterToken = "{counter}"
+
+// renameCounterWidth is the minimum number of digits of {counter}
+const renameCounterWidth = 4
+
+// renameValues are the details of an upload that fill in a rename template
+type renameValues struct {
+	name   string // sanitized file name
+	device string
+	date   time.Time
+	hash   string // hex SHA-256
+}
+
+// parseRenameTemplate validates a rename template such as
+// "{date}_{time}_{original}". Empty keeps the names sent by the phone.
+func parseRenameTemplate(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	for _, token := range folderTemplateToken.FindAllString(s, -1) {
+		if !renameTokens[token] {
+			return "", fmt.Errorf("unknown placeholder in rename template: %s", token)
+		}
+	}
+	if unsafeFilenameChars.MatchString(folderTemplateToken.ReplaceAllString(s, "")) {
+		return "", fmt.Errorf("rename template contains characters not allowed in file names: %s", s)
+	}
+	return s, nil
+}
+
+// expandRenameTemplate fills in a rename template except for {counter}.
+// Values are made safe for file names; the template itself is checked by
+// parseRenameTemplate.
+func expandRenameTemplate(tmpl string, v renameValues) string {
+	ext := filepath.Ext(v.name)
+	hash8 := v.hash
+	if len(hash8) > 8 {
+		hash8 = hash8[:8]
+	}
+	values := map[string]string{
+		"{date}":     v.date.Format("20060102"),
+		"{time}":     v.date.Format("150405"),
+		"{device}":   unsafeFilenameChars.ReplaceAllString(v.device, "_"),
+		"{original}": strings.TrimSuffix(v.name, ext),
+		"{ext}":      strings.TrimPrefix(ext, "."),
+		"{hash8}":    hash8,
+	}
+	out := folderTemplateToken.ReplaceAllStringFunc(tmpl, func(token string) string {
+		if v, ok := values[token]; ok {
+			return v
+		}
+		return token
+	})
+	if !strings.Contains(tmpl, "{ext}") {
+		out += ext
+	}
+	return out
+}
+
+// formatRenameCounter formats n as {counter} is shown
+func formatRenameCounter(n int) string {
+	return fmt.Sprintf("%0*d", renameCounterWidth, n)
+}
+
+// nextRenameCounter returns one more than the highest counter used by files
+// in dir whose names follow the expanded template
+func nextRenameCounter(dir, expanded string) int {
+	parts := strings.Split(expanded, renameCounterToken)
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	re, err := regexp.Compile("^" + strings.Join(parts, `(\d+)`) + "$")
+	if err != nil {
+		return 1
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 1
+	}
+	highest := 0
+	for _, e := range entries {
+		if m := re.FindStringSubmatch(e.Name()); m != nil {
+			if n, err := strconv.Atoi(m[1]); err == nil && n > highest {
+				highest = n
+			}
+		}
+	}
+	return highest + 1
+}
+
+// renameUpload applies the rename template of an upload to name, the file
+// name it is about to be saved under in dir. Called with placeMu held, so
+// {counter} cannot be handed out twice.
+func renameUpload(dir, name string, meta uploadMeta, path string) string {
+	if meta.RenameTemplate == "" {
+		return name
+	}
+
+	hash := meta.SHA256
+	if hash == "" && strings.Contains(meta.RenameTemplate, "{hash8}") {
+		hash = fileSHA256(path)
+	}
+	expanded := expandRenameTemplate(meta.RenameTemplate, renameValues{
+		name:   name,
+		device: meta.Device,
+		date:   meta.Date,
+		hash:   hash,
+	})
+	if strings.Contains(expanded, renameCounterToken) {
+		counter := formatRenameCounter(nextRenameCounter(dir, expanded))
+		expanded = strings.ReplaceAll(expanded, renameCounterToken, counter)
+	}
+	return sanitizeFilename(expanded)
+}
+
+// fileSHA256 returns the hex SHA-256 of a file, or "" if it cannot be read
+func fileSHA256(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// previewRename shows what a file named name would be saved as with the
+// given rename template, using sample values for the other details
+func previewRename(tmpl, name string) (string, error) {
+	tmpl, err := parseRenameTemplate(tmpl)
+	if err != nil {
+		return "", err
+	}
+	name = sanitizeFilename(name)
+	if tmpl == "" {
+		return name, nil
+	}
+	expanded := expandRenameTemplate(tmpl, renameValues{
+		name:   name,
+		device: "iPhone",
+		date:   time.Now(),
+		hash:   fmt.Sprintf("%x", sha256.Sum256([]byte(name))),
+	})
+	return sanitizeFilename(strings.ReplaceAll(expanded, renameCounterToken, formatRenameCounter(1))), nil
+}
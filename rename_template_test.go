@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseRenameTemplate(t *testing.T) {
+	valid := map[string]string{
+		"":                         "",
+		"  ":                       "",
+		"{date}_{time}_{original}": "{date}_{time}_{original}",
+		" {device}-{counter} ":     "{device}-{counter}",
+		"{original}.backup.{ext}":  "{original}.backup.{ext}",
+		"{hash8}":                  "{hash8}",
+		"photo":                    "photo",
+	}
+	for in, want := range valid {
+		got, err := parseRenameTemplate(in)
+		if err != nil || got != want {
+			t.Errorf("parseRenameTemplate(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{
+		"{name}",
+		"{date}_{Original}",
+		"{date}/{original}",
+		`{date}\{original}`,
+		"{original}:{counter}",
+		"photo?",
+		"{original}\x01",
+	} {
+		if got, err := parseRenameTemplate(in); err == nil {
+			t.Errorf("parseRenameTemplate(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestPreviewRename(t *testing.T) {
+	hash8 := fmt.Sprintf("%x", sha256.Sum256([]byte("IMG_0001.HEIC")))[:8]
+	tests := []struct {
+		tmpl, name string
+		want       string // regular expression
+	}{
+		{"", "IMG_0001.HEIC", `^IMG_0001\.HEIC$`},
+		{"", "../IMG_0001.HEIC", `^IMG_0001\.HEIC$`},
+		{"{original}_{counter}", "IMG_0001.HEIC", `^IMG_0001_0001\.HEIC$`},
+		{"{date}_{time}_{original}", "IMG_0001.HEIC", `^\d{8}_\d{6}_IMG_0001\.HEIC$`},
+		{"{device}_{original}", "IMG_0001.HEIC", `^iPhone_IMG_0001\.HEIC$`},
+		{"{hash8}", "IMG_0001.HEIC", `^` + hash8 + `\.HEIC$`},
+		{"{original}.{ext}.bak", "IMG_0001.HEIC", `^IMG_0001\.HEIC\.bak$`},
+		{"scan", "notes", `^scan$`},
+	}
+	for _, tt := range tests {
+		got, err := previewRename(tt.tmpl, tt.name)
+		if err != nil {
+			t.Errorf("previewRename(%q, %q): %v", tt.tmpl, tt.name, err)
+			continue
+		}
+		if !regexp.MustCompile(tt.want).MatchString(got) {
+			t.Errorf("previewRename(%q, %q) = %q, want a match for %s", tt.tmpl, tt.name, got, tt.want)
+		}
+	}
+
+	if got, err := previewRename("{nope}", "a.jpg"); err == nil {
+		t.Errorf("previewRename with an unknown placeholder = %q, want an error", got)
+	}
+}
+
+func TestExpandRenameTemplate(t *testing.T) {
+	v := renameValues{
+		name:   "IMG_0001.jpg",
+		device: `Pixel 8 (192.168.1.5:"x")`,
+		date:   time.Date(2026, 3, 14, 15, 9, 26, 0, time.Local),
+		hash:   "0123456789abcdef",
+	}
+	tests := map[string]string{
+		"{date}_{time}_{original}": "20260314_150926_IMG_0001.jpg",
+		"{device}":                 "Pixel 8 (192.168.1.5__x_).jpg",
+		"{hash8}-{counter}":        "01234567-{counter}.jpg",
+		"{ext}_{original}":         "jpg_IMG_0001",
+	}
+	for tmpl, want := range tests {
+		if got := expandRenameTemplate(tmpl, v); got != want {
+			t.Errorf("expandRenameTemplate(%q) = %q, want %q", tmpl, got, want)
+		}
+	}
+}
+
+func TestRenameUploadCounter(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"trip_0001.jpg", "trip_0007.jpg", "trip_0002.png", "other_0042.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta := uploadMeta{RenameTemplate: "trip_{counter}"}
+	if got := renameUpload(dir, "IMG_0001.jpg", meta, ""); got != "trip_0008.jpg" {
+		t.Errorf("renameUpload = %q, want trip_0008.jpg", got)
+	}
+	if got := renameUpload(dir, "IMG_0001.gif", meta, ""); got != "trip_0001.gif" {
+		t.Errorf("renameUpload = %q, want trip_0001.gif", got)
+	}
+	if got := renameUpload(dir, "IMG_0001.jpg", uploadMeta{}, ""); got != "IMG_0001.jpg" {
+		t.Errorf("renameUpload without a template = %q", got)
+	}
+}
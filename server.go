@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,15 +21,42 @@ type FileServer struct {
 	lanIP    string
 	running  bool
 	app      *App
+	chunked  *chunkedUploads
+	compress *compressQueue
+	dupes    *duplicateIndex
+	auth     *sessionAuth
+	shelf    *shareShelf
+	texts    *textHub
+	useTLS   bool
+	tlsCert  atomic.Pointer[tls.Certificate]
+	mu       sync.RWMutex  // guards server, port, lanIP, running, useTLS and stopped
+	placeMu  sync.Mutex    // serializes choosing a free file name and renaming into it
+	stopped  chan struct{} // closed when the server stops
 }
 
+// lanIPCheckInterval is how often the LAN IP is re-checked while running
+const lanIPCheckInterval = 10 * time.Second
+
 // NewFileServer creates a new FileServer instance
 func NewFileServer(app *App) *FileServer {
-	return &FileServer{app: app}
+	fs := &FileServer{
+		app:     app,
+		chunked: newChunkedUploads(),
+		auth:    newSessionAuth(),
+		shelf:   newShareShelf(),
+		texts:   newTextHub(),
+	}
+	fs.auth.onChange = app.notifyPairingChanged
+	fs.compress = newCompressQueue(fs.runCompressTask, app.emitCompressProgress)
+	fs.dupes = newDuplicateIndex(app.store.readAll)
+	return fs
 }
 
-// Start starts the HTTP server on an available port
+// Start starts the HTTP server on an available port. The server state is
+// set before it starts serving, so handlers always see the current run.
 func (fs *FileServer) Start() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 	if fs.running {
 		return fmt.Errorf("server is already running")
 	}
@@ -38,75 +68,224 @@ func (fs *FileServer) Start() error {
 	}
 	fs.lanIP = ip
 
+	// Load or generate the TLS certificate when HTTPS is enabled
+	useTLS := fs.app.settings().UseHTTPS
+	if useTLS {
+		cert, err := loadOrCreateCertificate(ip)
+		if err != nil {
+			return fmt.Errorf("failed to prepare TLS certificate: %w", err)
+		}
+		fs.tlsCert.Store(cert)
+	}
+
 	// Find available port
 	listener, err := net.Listen("tcp", "0.0.0.0:0")
 	if err != nil {
 		return fmt.Errorf("failed to find available port: %w", err)
 	}
-	fs.port = listener.Addr().(*net.TCPAddr).Port
+	port := listener.Addr().(*net.TCPAddr).Port
 	listener.Close()
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/upload", fs.handleUploadPage)
-	mux.HandleFunc("/api/upload", fs.handleFileUpload)
+	mux.HandleFunc("/download", fs.handleDownloadPage)
+	mux.HandleFunc("/api/pair", fs.handlePair)
+	mux.HandleFunc("/api/upload", fs.requireSession(fs.requireApproval(fs.handleFileUpload)))
+	mux.HandleFunc("/api/uploads", fs.requireSession(fs.requireApproval(fs.handleCreateUpload)))
+	mux.HandleFunc("/api/uploads/{id}", fs.requireSession(fs.requireApproval(fs.handleResumableUpload)))
+	mux.HandleFunc("/api/files", fs.requireSession(fs.handleListFiles))
+	mux.HandleFunc("/api/files/{id}", fs.requireSession(fs.handleDownloadFile))
+	mux.HandleFunc("/api/text", fs.requireSession(fs.handleText))
+	mux.HandleFunc("/api/text/stream", fs.requireSession(fs.handleTextStream))
 
-	fs.server = &http.Server{
-		Addr:              fmt.Sprintf("0.0.0.0:%d", fs.port),
+	server := &http.Server{
+		Addr:              fmt.Sprintf("0.0.0.0:%d", port),
 		Handler:           mux,
 		ReadHeaderTimeout: 10 * time.Second,
 		// No ReadTimeout to allow large file uploads
 		WriteTimeout:   0,
 		MaxHeaderBytes: 1 << 20, // 1MB
 	}
+	if useTLS {
+		server.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			// Served through a callback so the certificate can be swapped when the LAN IP changes
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return fs.tlsCert.Load(), nil
+			},
+		}
+	}
+
+	fs.server = server
+	fs.port = port
+	fs.useTLS = useTLS
+	fs.stopped = make(chan struct{})
+	fs.running = true
 
 	go func() {
-		log.Printf("HTTP server starting on 0.0.0.0:%d", fs.port)
-		if err := fs.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("HTTP server starting on 0.0.0.0:%d (TLS: %v)", port, useTLS)
+		var err error
+		if useTLS {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Printf("HTTP server error: %v", err)
 		}
 	}()
+	go fs.watchLANIP(fs.stopped, useTLS)
 
-	fs.running = true
-	log.Printf("Upload URL: http://%s:%d/upload", fs.lanIP, fs.port)
+	log.Printf("Upload URL: %s://%s:%d/upload", schemeFor(useTLS), ip, port)
 	return nil
 }
 
 // Stop gracefully stops the HTTP server
 func (fs *FileServer) Stop() error {
+	fs.mu.Lock()
 	if !fs.running || fs.server == nil {
+		fs.mu.Unlock()
 		return nil
 	}
+	server := fs.server
+	close(fs.stopped)
+	fs.running = false
+	// Unlocked while shutting down, as handlers still finishing read the state
+	fs.mu.Unlock()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := fs.server.Shutdown(ctx)
-	fs.running = false
+	err := server.Shutdown(ctx)
 	log.Println("HTTP server stopped")
 	return err
 }
 
-// GetUploadURL returns the upload URL with language parameter
+// Restart stops and starts the server, picking up config changes such as HTTPS
+func (fs *FileServer) Restart() error {
+	if err := fs.Stop(); err != nil {
+		log.Printf("Failed to stop HTTP server cleanly: %v", err)
+	}
+	return fs.Start()
+}
+
+// watchLANIP follows LAN IP changes (e.g. switching Wi-Fi networks) so the
+// upload URL stays correct and the TLS certificate keeps matching
+func (fs *FileServer) watchLANIP(stop chan struct{}, useTLS bool) {
+	ticker := time.NewTicker(lanIPCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ip, err := getLANIP()
+		if err != nil || ip == fs.GetLANIP() {
+			continue
+		}
+		log.Printf("LAN IP changed: %s -> %s", fs.GetLANIP(), ip)
+
+		if useTLS {
+			cert, err := loadOrCreateCertificate(ip)
+			if err != nil {
+				log.Printf("Failed to regenerate TLS certificate: %v", err)
+				continue
+			}
+			fs.tlsCert.Store(cert)
+		}
+		fs.setLANIP(ip)
+		fs.auth.notify()
+	}
+}
+
+// scheme returns "https" when TLS is enabled, otherwise "http"
+func (fs *FileServer) scheme() string {
+	return schemeFor(fs.usingTLS())
+}
+
+// schemeFor returns the URL scheme of a server with or without TLS
+func schemeFor(useTLS bool) string {
+	if useTLS {
+		return "https"
+	}
+	return "http"
+}
+
+// usingTLS returns whether the server was started with HTTPS
+func (fs *FileServer) usingTLS() bool {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.useTLS
+}
+
+// stopSignal returns the channel closed when the current run of the server
+// stops
+func (fs *FileServer) stopSignal() <-chan struct{} {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.stopped
+}
+
+// GetUploadURL returns the upload URL with language and one-time pairing
+// parameters. Over HTTPS the certificate fingerprint is included so users
+// can check it against what their browser shows.
 func (fs *FileServer) GetUploadURL() string {
-	if !fs.running {
+	if !fs.IsRunning() {
 		return ""
 	}
 	lang := fs.app.GetLang()
-	return fmt.Sprintf("http://%s:%d/upload?lang=%s", fs.lanIP, fs.port, lang)
+	u := fmt.Sprintf("%s://%s:%d/upload?lang=%s&pair=%s", fs.scheme(), fs.GetLANIP(), fs.GetPort(), lang, fs.auth.PairSecret())
+	if fp := fs.GetCertFingerprint(); fp != "" {
+		u += "&fp=" + strings.ReplaceAll(fp, ":", "")[:16]
+	}
+	return u
+}
+
+// GetCertFingerprint returns the SHA-256 fingerprint of the TLS certificate, or "" over HTTP
+func (fs *FileServer) GetCertFingerprint() string {
+	if !fs.usingTLS() {
+		return ""
+	}
+	cert := fs.tlsCert.Load()
+	if cert == nil {
+		return ""
+	}
+	return certFingerprint(cert)
+}
+
+// GetPairingPIN returns the PIN a device can enter instead of scanning the QR code
+func (fs *FileServer) GetPairingPIN() string {
+	return fs.auth.PIN()
 }
 
 // GetPort returns the server port
 func (fs *FileServer) GetPort() int {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
 	return fs.port
 }
 
 // GetLANIP returns the LAN IP address
 func (fs *FileServer) GetLANIP() string {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
 	return fs.lanIP
 }
 
+// setLANIP updates the LAN IP address
+func (fs *FileServer) setLANIP(ip string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.lanIP = ip
+}
+
 // IsRunning returns whether the server is running
 func (fs *FileServer) IsRunning() bool {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
 	return fs.running
 }
 
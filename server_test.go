@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestServerRestartWhileInUse(t *testing.T) {
+	fs, _ := newTestFileServer(t, Config{})
+	if err := fs.Start(); err != nil {
+		t.Skipf("cannot start the server here: %v", err)
+	}
+	first := fs.stopSignal()
+
+	// Handlers and the GUI read the server state while it restarts
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				fs.IsRunning()
+				fs.GetUploadURL()
+				fs.GetCertFingerprint()
+				fs.stopSignal()
+			}
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		if err := fs.Restart(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	select {
+	case <-first:
+	default:
+		t.Error("stop signal of the first run was not closed")
+	}
+	current := fs.stopSignal()
+	if err := fs.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-current:
+	default:
+		t.Error("stop signal was not closed by Stop")
+	}
+	if fs.IsRunning() || fs.GetUploadURL() != "" {
+		t.Error("server still reported as running")
+	}
+}
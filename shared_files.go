@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultShareExpiryMinutes is how long a shared file stays available by default
+const defaultShareExpiryMinutes = 60
+
+// SharedFile is a local file offered for download to paired devices
+type SharedFile struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Path      string `json:"path"`
+	AddedAt   string `json:"addedAt"`
+	ExpiresAt string `json:"expiresAt"`
+
+	expires time.Time
+}
+
+// shareShelf holds the files currently offered to the phone
+type shareShelf struct {
+	mu    sync.Mutex
+	items map[string]*SharedFile
+}
+
+// newShareShelf creates an empty shelf
+func newShareShelf() *shareShelf {
+	return &shareShelf{items: make(map[string]*SharedFile)}
+}
+
+// Add puts a local file on the shelf for ttl
+func (s *shareShelf) Add(path string, ttl time.Duration) (SharedFile, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return SharedFile{}, err
+	}
+	if st.IsDir() {
+		return SharedFile{}, fmt.Errorf("%s is a directory", path)
+	}
+
+	now := time.Now()
+	item := &SharedFile{
+		ID:        hex.EncodeToString(randomBytes(12)),
+		Name:      filepath.Base(path),
+		Size:      st.Size(),
+		Path:      path,
+		AddedAt:   now.Format("2006-01-02 15:04:05"),
+		ExpiresAt: now.Add(ttl).Format("2006-01-02 15:04:05"),
+		expires:   now.Add(ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[item.ID] = item
+	log.Printf("Shared file added: %s (expires %s)", path, item.ExpiresAt)
+	return *item, nil
+}
+
+// Get returns a shared file if it exists and has not expired
+func (s *shareShelf) Get(id string) (SharedFile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked()
+	item, ok := s.items[id]
+	if !ok {
+		return SharedFile{}, false
+	}
+	return *item, true
+}
+
+// List returns the shared files, newest first
+func (s *shareShelf) List() []SharedFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked()
+
+	result := make([]SharedFile, 0, len(s.items))
+	for _, item := range s.items {
+		result = append(result, *item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].AddedAt > result[j].AddedAt
+	})
+	return result
+}
+
+// Remove takes a file off the shelf
+func (s *shareShelf) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[id]; !ok {
+		return false
+	}
+	delete(s.items, id)
+	return true
+}
+
+// pruneLocked drops expired items. Caller must hold mu.
+func (s *shareShelf) pruneLocked() {
+	now := time.Now()
+	for id, item := range s.items {
+		if now.After(item.expires) {
+			log.Printf("Shared file expired: %s", item.Path)
+			delete(s.items, id)
+		}
+	}
+}
+
+// downloadPageData is passed to the download page template
+type downloadPageData struct {
+	T     uploadTexts
+	Files []SharedFile
+}
+
+var downloadPageTemplate = template.Must(template.New("download").Funcs(template.FuncMap{
+	"formatSize": formatSize,
+}).Parse(downloadPageTmpl))
+
+// formatSize formats a byte count for display
+func formatSize(bytes int64) string {
+	switch {
+	case bytes < 1024:
+		return fmt.Sprintf("%d B", bytes)
+	case bytes < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
+	case bytes < 1024*1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+	}
+	return fmt.Sprintf("%.2f GB", float64(bytes)/(1024*1024*1024))
+}
+
+// handleDownloadPage serves the mobile page listing files shared from the PC
+func (fs *FileServer) handleDownloadPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+	texts, ok := uploadTranslations[lang]
+	if !ok {
+		texts = uploadTranslations["ja"]
+	}
+
+	if _, ok := fs.auth.validate(requestToken(r)); !ok {
+		servePairPage(w, texts)
+		return
+	}
+
+	var buf bytes.Buffer
+	data := downloadPageData{T: texts, Files: fs.shelf.List()}
+	if err := downloadPageTemplate.Execute(&buf, data); err != nil {
+		log.Printf("Failed to render download page: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(buf.Bytes())
+}
+
+// handleListFiles returns the shared files as JSON (GET /api/files)
+func (fs *FileServer) handleListFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	files := fs.shelf.List()
+	list := make([]map[string]interface{}, 0, len(files))
+	for _, f := range files {
+		// Do not expose local paths to the phone
+		list = append(list, map[string]interface{}{
+			"id":        f.ID,
+			"name":      f.Name,
+			"size":      f.Size,
+			"expiresAt": f.ExpiresAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"files": list,
+	})
+}
+
+// handleDownloadFile streams a shared file (GET /api/files/{id}).
+// http.ServeContent handles Range and conditional requests, which iOS
+// Safari relies on for media and large downloads.
+func (fs *FileServer) handleDownloadFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	item, ok := fs.shelf.Get(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(item.Path)
+	if err != nil {
+		log.Printf("Failed to open shared file %s: %v", item.Path, err)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if ctype := mime.TypeByExtension(filepath.Ext(item.Name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(item.Name))
+	http.ServeContent(w, r, item.Name, st.ModTime(), f)
+
+	if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+		log.Printf("Shared file downloaded: %s", item.Path)
+	}
+}
+
+// downloadPageTmpl is the Go template for the mobile download page
+const downloadPageTmpl = `<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0, maximum-scale=1.0, user-scalable=no">
+<title>{{.T.PageTitle}}</title>
+<style>
+* { box-sizing: border-box; margin: 0; padding: 0; }
+body {
+  font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+  background: #0f172a;
+  color: #e2e8f0;
+  min-height: 100vh;
+  padding: 20px;
+}
+.container { max-width: 480px; margin: 0 auto; }
+h1 { font-size: 1.5rem; text-align: center; margin-bottom: 8px; color: #38bdf8; }
+.nav { text-align: center; margin-bottom: 24px; font-size: 0.9rem; }
+.nav a { color: #94a3b8; }
+.file-item {
+  display: flex;
+  justify-content: space-between;
+  align-items: center;
+  background: #1e293b;
+  padding: 12px 14px;
+  border-radius: 8px;
+  margin-bottom: 8px;
+  color: #e2e8f0;
+  text-decoration: none;
+}
+.file-item .name { flex: 1; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; margin-right: 8px; }
+.file-item .size { color: #94a3b8; white-space: nowrap; font-size: 0.85rem; }
+.empty { color: #64748b; text-align: center; padding: 32px 0; }
+.reload {
+  display: block;
+  width: 100%;
+  margin-top: 16px;
+  padding: 14px;
+  background: #334155;
+  color: #e2e8f0;
+  border: none;
+  border-radius: 8px;
+  font-size: 1rem;
+}
+</style>
+</head>
+<body>
+<div class="container">
+  <h1>{{.T.FromPC}}</h1>
+  <div class="nav"><a href="/upload?lang={{.T.Lang}}">{{.T.ToPC}}</a></div>
+  {{range .Files}}
+  <a class="file-item" href="/api/files/{{.ID}}" download="{{.Name}}">
+    <span class="name">{{.Name}}</span>
+    <span class="size">{{formatSize .Size}}</span>
+  </a>
+  {{else}}
+  <div class="empty">{{.T.NoSharedFiles}}</div>
+  {{end}}
+  <button class="reload" onclick="location.reload()">{{.T.Refresh}}</button>
+</div>
+</body>
+</html>`
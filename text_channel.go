@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// maxTextSize is the largest text message accepted from the phone (64KB)
+const maxTextSize = 64 << 10
+
+// maxTextHistory is the number of text messages kept in memory
+const maxTextHistory = 50
+
+// textKeepAlive is how often an idle event stream sends a comment to stay open
+const textKeepAlive = 25 * time.Second
+
+// TextMessage is a piece of text sent between the phone and the PC
+type TextMessage struct {
+	ID        int64  `json:"id"`
+	Text      string `json:"text"`
+	From      string `json:"from"` // "phone" or "pc"
+	Device    string `json:"device,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// textHub fans out PC → phone text messages to connected event streams
+type textHub struct {
+	mu          sync.Mutex
+	nextID      int64
+	subscribers map[chan TextMessage]struct{}
+	outbox      []TextMessage // recent PC → phone messages for polling clients
+}
+
+// newTextHub creates a hub with no subscribers
+func newTextHub() *textHub {
+	return &textHub{subscribers: make(map[chan TextMessage]struct{})}
+}
+
+// newMessage stamps a message with the next ID and the current time
+func (h *textHub) newMessage(text, from, device string) TextMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	return TextMessage{
+		ID:        h.nextID,
+		Text:      text,
+		From:      from,
+		Device:    device,
+		Timestamp: time.Now().Format("2006-01-02 15:04:05"),
+	}
+}
+
+// publish delivers a PC → phone message to all streams and keeps it for polling
+func (h *textHub) publish(msg TextMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.outbox = append(h.outbox, msg)
+	if len(h.outbox) > maxTextHistory {
+		h.outbox = h.outbox[len(h.outbox)-maxTextHistory:]
+	}
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- msg:
+		default:
+			// Slow client; it can catch up by polling
+		}
+	}
+}
+
+// since returns PC → phone messages newer than id
+func (h *textHub) since(id int64) []TextMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := make([]TextMessage, 0)
+	for _, msg := range h.outbox {
+		if msg.ID > id {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// subscribe registers a new event stream
+func (h *textHub) subscribe() chan TextMessage {
+	ch := make(chan TextMessage, 16)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+// unsubscribe removes an event stream
+func (h *textHub) unsubscribe(ch chan TextMessage) {
+	h.mu.Lock()
+	delete(h.subscribers, ch)
+	h.mu.Unlock()
+}
+
+// handleText receives text from the phone (POST) or returns PC → phone
+// messages newer than ?after= (GET, for clients without EventSource)
+func (fs *FileServer) handleText(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		after, _ := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"messages": fs.texts.since(after),
+		})
+
+	case http.MethodPost:
+		// Only incoming text needs the device to be approved
+		fs.requireApproval(fs.handlePostText)(w, r)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePostText receives text sent from the phone
+func (fs *FileServer) handlePostText(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxTextSize+1024)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Invalid request or text too long (max 64KB)",
+		})
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" || !utf8.ValidString(req.Text) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Text is empty",
+		})
+		return
+	}
+	if len(req.Text) > maxTextSize {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+			"error": "Text is too long (max 64KB)",
+		})
+		return
+	}
+
+	device := deviceLabel(r)
+	msg := fs.texts.newMessage(req.Text, "phone", device)
+	fs.app.receiveText(msg)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": msg,
+	})
+}
+
+// handleTextStream pushes PC → phone text as server-sent events
+func (fs *FileServer) handleTextStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Streams never end on their own, so leave when the server stops
+	stopped := fs.stopSignal()
+
+	ch := fs.texts.subscribe()
+	defer fs.texts.unsubscribe(ch)
+
+	keepAlive := time.NewTicker(textKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case msg := <-ch:
+			data, _ := json.Marshal(msg)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", msg.ID, data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-stopped:
+			return
+		}
+	}
+}
+
+// receiveText stores text from the phone, notifies the frontend and
+// optionally copies it to the clipboard
+func (a *App) receiveText(msg TextMessage) {
+	a.addTextMessage(msg)
+	log.Printf("Text received from %s (%d chars)", msg.Device, utf8.RuneCountInString(msg.Text))
+
+	if a.ctx == nil {
+		return
+	}
+	if a.settings().AutoCopyText {
+		if err := runtime.ClipboardSetText(a.ctx, msg.Text); err != nil {
+			log.Printf("Failed to copy text to clipboard: %v", err)
+		}
+	}
+	runtime.EventsEmit(a.ctx, "text:received", msg)
+}
+
+// addTextMessage adds a message to the text history (max maxTextHistory)
+func (a *App) addTextMessage(msg TextMessage) {
+	a.textMu.Lock()
+	defer a.textMu.Unlock()
+
+	a.textHistory = append([]TextMessage{msg}, a.textHistory...)
+	if len(a.textHistory) > maxTextHistory {
+		a.textHistory = a.textHistory[:maxTextHistory]
+	}
+}
+
+// GetTextHistory returns text sent in both directions, newest first
+func (a *App) GetTextHistory() []TextMessage {
+	a.textMu.Lock()
+	defer a.textMu.Unlock()
+
+	result := make([]TextMessage, len(a.textHistory))
+	copy(result, a.textHistory)
+	return result
+}
+
+// SendTextToPhone pushes text to connected phones
+func (a *App) SendTextToPhone(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("text is empty")
+	}
+	if len(text) > maxTextSize {
+		return fmt.Errorf("text is too long (max 64KB)")
+	}
+
+	msg := a.fileServer.texts.newMessage(text, "pc", "")
+	a.addTextMessage(msg)
+	a.fileServer.texts.publish(msg)
+	return nil
+}
+
+// CopyTextToClipboard copies text to the system clipboard
+func (a *App) CopyTextToClipboard(text string) error {
+	return runtime.ClipboardSetText(a.ctx, text)
+}
+
+// GetAutoCopyText returns whether received text is copied to the clipboard automatically
+func (a *App) GetAutoCopyText() bool {
+	return a.settings().AutoCopyText
+}
+
+// SetAutoCopyText sets whether received text is copied to the clipboard automatically
+func (a *App) SetAutoCopyText(enabled bool) error {
+	return a.updateConfig(func(cfg *Config) error {
+		cfg.AutoCopyText = enabled
+		return nil
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// certValidity is how long a generated certificate is valid
+const certValidity = 365 * 24 * time.Hour
+
+// certRenewBefore regenerates the certificate when it expires within this window
+const certRenewBefore = 30 * 24 * time.Hour
+
+// getCertPaths returns the certificate and key file paths in the config directory
+func getCertPaths() (certPath, keyPath string) {
+	dir := filepath.Join(getConfigDir(), "tls")
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+}
+
+// loadOrCreateCertificate loads the stored self-signed certificate, generating
+// a new one when it is missing, expiring, or does not cover lanIP
+func loadOrCreateCertificate(lanIP string) (*tls.Certificate, error) {
+	certPath, keyPath := getCertPaths()
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil && certificateCovers(&cert, lanIP) {
+		return &cert, nil
+	}
+	if err == nil {
+		log.Printf("TLS certificate does not match LAN IP %s or is expiring, regenerating", lanIP)
+	}
+
+	return generateCertificate(lanIP, certPath, keyPath)
+}
+
+// certificateCovers reports whether cert is valid for lanIP and not about to expire
+func certificateCovers(cert *tls.Certificate, lanIP string) bool {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false
+	}
+	if time.Now().Add(certRenewBefore).After(leaf.NotAfter) {
+		return false
+	}
+	ip := net.ParseIP(lanIP)
+	for _, candidate := range leaf.IPAddresses {
+		if candidate.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateCertificate creates a self-signed ECDSA certificate for lanIP and
+// stores it in the config directory
+func generateCertificate(lanIP, certPath, keyPath string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "File Bridge " + lanIP},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP(lanIP), net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write key: %w", err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Generated TLS certificate for %s (SHA-256 %s)", lanIP, certFingerprint(&cert))
+	return &cert, nil
+}
+
+// certFingerprint returns the SHA-256 fingerprint of a certificate as
+// colon-separated uppercase hex, the format browsers show
+func certFingerprint(cert *tls.Certificate) string {
+	sum := sha256.Sum256(cert.Certificate[0])
+	hexStr := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	parts := make([]string, 0, len(sum))
+	for i := 0; i < len(hexStr); i += 2 {
+		parts = append(parts, hexStr[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
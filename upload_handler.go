@@ -2,12 +2,15 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -24,16 +27,57 @@ type UploadRecord struct {
 	SavePath     string `json:"savePath"`
 	Compressed   bool   `json:"compressed,omitempty"`
 	OriginalSize int64  `json:"originalSize,omitempty"`
+	Device       string `json:"device,omitempty"`
+	Exists       bool   `json:"exists"`
+
+	MetadataStripped bool   `json:"metadataStripped,omitempty"` // GPS and personal tags removed
+	Status           string `json:"status,omitempty"`           // "queued" while waiting for compression
+	SHA256           string `json:"sha256,omitempty"`           // hash of the bytes received from the phone
+	DuplicateOf      string `json:"duplicateOf,omitempty"`      // existing file with the same content
+	ConflictAction   string `json:"conflictAction,omitempty"`   // what was done about a name conflict
+	Folder           string `json:"folder,omitempty"`           // folder under the save directory, "/"-separated
+	Rule             string `json:"rule,omitempty"`             // upload rule that routed the file
+	ContentType      string `json:"contentType,omitempty"`      // sniffed from the first bytes
+	ExtMismatch      string `json:"extMismatch,omitempty"`      // "fixed" or "flagged" when the extension did not match
 }
 
-// maxUploadSize is the max upload size (2GB)
+// uploadDuplicate is the UploadRecord.Status of a file skipped as a duplicate
+const uploadDuplicate = "duplicate"
+
+// uploadMeta carries per-file details from the request into the save pipeline
+type uploadMeta struct {
+	Name     string    // sanitized file name
+	Device   string    // sending device, recorded in the history
+	SHA256   string    // verified hash of the received bytes
+	Conflict string    // conflict policy for this upload, "" for the configured one
+	ModTime  time.Time // modification time on the phone, zero if unknown
+	Folder   string    // sanitized folder under the save directory, "/"-separated
+	Rule     string    // name of the upload rule that matched
+	Compress string    // compression override from the rule
+
+	ContentType    string    // sniffed from the first bytes
+	ExtMismatch    string    // extFixed or extFlagged when the extension did not match the content
+	RenameTemplate string    // rename template from the rule or the config, "" = keep the name
+	Date           time.Time // date taken, for date folders and rename templates
+}
+
+// maxUploadSize is the max size of each uploaded file (2GB)
 const maxUploadSize = 2 << 30
 
+// maxCompressSize is the largest image that is decoded for compression.
+// Bigger files are saved as they are to keep memory use bounded.
+const maxCompressSize = 64 << 20
+
+// tempUploadSuffix marks files in the staging directory that are still being written
+const tempUploadSuffix = ".tmp"
+
 // uploadTexts holds translations for the mobile upload page
 type uploadTexts struct {
+	Lang          string
 	PageTitle     string
 	Heading       string
 	SelectFiles   string
+	SelectFolder  string
 	FileHint      string
 	UploadBtn     string
 	Uploading     string
@@ -42,13 +86,34 @@ type uploadTexts struct {
 	UploadFailed  string
 	NetworkError  string
 	Cancelled     string
+	Reconnecting  string
+	Checking      string
+	Duplicates    string
+	Rejected      string
+	PinPrompt     string
+	PairBtn       string
+	PinInvalid    string
+	PinLocked     string
+	AwaitApproval string
+	FromPC        string
+	ToPC          string
+	NoSharedFiles string
+	Refresh       string
+	SendText      string
+	SendTextBtn   string
+	TextSent      string
+	TextFromPC    string
+	Copy          string
+	Copied        string
 }
 
 var uploadTranslations = map[string]uploadTexts{
 	"ja": {
+		Lang:          "ja",
 		PageTitle:     "File Bridge - アップロード",
 		Heading:       "File Bridge",
 		SelectFiles:   "ファイルを選択",
+		SelectFolder:  "フォルダを選択",
 		FileHint:      "画像・動画・PDF など",
 		UploadBtn:     "アップロード",
 		Uploading:     "アップロード中...",
@@ -57,11 +122,32 @@ var uploadTranslations = map[string]uploadTexts{
 		UploadFailed:  "アップロードに失敗しました",
 		NetworkError:  "ネットワークエラーです。接続を確認してください。",
 		Cancelled:     "アップロードがキャンセルされました。",
+		Reconnecting:  "接続が切れました。再接続して続きから再開します...",
+		Checking:      "ファイルを確認中...",
+		Duplicates:    "PCに同じファイルがあるためスキップ: ",
+		Rejected:      "受け付けられないファイル形式: ",
+		PinPrompt:     "PCのFile Bridgeに表示されている6桁のPINを入力してください",
+		PairBtn:       "接続",
+		PinInvalid:    "PINが正しくありません",
+		PinLocked:     "PINの入力が多すぎます。しばらく待ってから再度お試しください",
+		AwaitApproval: "PCでの承認を待っています...",
+		FromPC:        "PCから受け取る",
+		ToPC:          "PCに送る",
+		NoSharedFiles: "共有されているファイルはありません",
+		Refresh:       "更新",
+		SendText:      "テキストを送る",
+		SendTextBtn:   "送信",
+		TextSent:      "テキストを送信しました",
+		TextFromPC:    "PCからのテキスト",
+		Copy:          "コピー",
+		Copied:        "コピーしました",
 	},
 	"en": {
+		Lang:          "en",
 		PageTitle:     "File Bridge - Upload",
 		Heading:       "File Bridge",
 		SelectFiles:   "Select Files",
+		SelectFolder:  "Select Folder",
 		FileHint:      "Images, videos, PDFs, etc.",
 		UploadBtn:     "Upload",
 		Uploading:     "Uploading...",
@@ -70,6 +156,25 @@ var uploadTranslations = map[string]uploadTexts{
 		UploadFailed:  "Upload failed",
 		NetworkError:  "Network error. Please check your connection.",
 		Cancelled:     "Upload cancelled.",
+		Reconnecting:  "Connection lost. Reconnecting to resume...",
+		Checking:      "Checking file...",
+		Duplicates:    "Skipped, already on the PC: ",
+		Rejected:      "File type not accepted: ",
+		PinPrompt:     "Enter the 6-digit PIN shown in File Bridge on your PC",
+		PairBtn:       "Connect",
+		PinInvalid:    "Incorrect PIN",
+		PinLocked:     "Too many attempts. Wait a moment and try again.",
+		AwaitApproval: "Waiting for approval on the PC...",
+		FromPC:        "Files from PC",
+		ToPC:          "Send to PC",
+		NoSharedFiles: "No files shared from the PC",
+		Refresh:       "Refresh",
+		SendText:      "Send text",
+		SendTextBtn:   "Send",
+		TextSent:      "Text sent",
+		TextFromPC:    "Text from PC",
+		Copy:          "Copy",
+		Copied:        "Copied",
 	},
 }
 
@@ -88,6 +193,23 @@ func (fs *FileServer) handleUploadPage(w http.ResponseWriter, r *http.Request) {
 		texts = uploadTranslations["ja"]
 	}
 
+	// Pair via the one-time secret from the QR code, then drop it from the URL
+	if secret := r.URL.Query().Get("pair"); secret != "" {
+		if token, ok := fs.auth.pairWithSecret(secret, r); ok {
+			setSessionCookie(w, r, token)
+			http.Redirect(w, r, "/upload?lang="+url.QueryEscape(lang), http.StatusSeeOther)
+			return
+		}
+	}
+
+	if _, ok := fs.auth.validate(requestToken(r)); !ok {
+		servePairPage(w, texts)
+		return
+	}
+
+	// Make sure the device has a stable ID before it starts uploading
+	deviceID(w, r)
+
 	var buf bytes.Buffer
 	if err := uploadPageTemplate.Execute(&buf, texts); err != nil {
 		log.Printf("Failed to render upload page: %v", err)
@@ -123,158 +245,521 @@ func (fs *FileServer) handleFileUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse multipart form with streaming (32MB buffer, rest goes to disk temp)
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		log.Printf("Failed to parse multipart form: %v", err)
+	// The uploader may override the configured name conflict policy
+	conflict, err := parseConflictPolicy(r.URL.Query().Get("conflict"))
+	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{
-			"error": "Failed to parse upload. File may be too large (max 2GB).",
+			"error": err.Error(),
 		})
 		return
 	}
-	defer r.MultipartForm.RemoveAll()
 
-	files := r.MultipartForm.File["files"]
-	if len(files) == 0 {
+	// Stream each part straight to disk instead of buffering the whole form
+	mr, err := r.MultipartReader()
+	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{
-			"error": "No files uploaded",
+			"error": "Invalid upload request",
 		})
 		return
 	}
 
-	// Get compression settings
-	compressEnabled := fs.app.config.CompressImages
-	imageQuality := fs.app.config.ImageQuality
-	keepOriginal := fs.app.config.KeepOriginal
-
 	var results []UploadRecord
-
-	for _, fh := range files {
-		// Sanitize filename
-		safeName := sanitizeFilename(fh.Filename)
-
-		// Open uploaded file
-		src, err := fh.Open()
+	rejected := []RejectedUpload{}
+	received := 0
+	device := deviceLabel(r)
+	checksum := ""        // from a "sha256" field, applies to the next file
+	var modTime time.Time // from a "lastModified" field, applies to the next file
+	relativePath := ""    // from a "relativePath" field (folder uploads), applies to the next file
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			log.Printf("Failed to open uploaded file %s: %v", fh.Filename, err)
+			log.Printf("Failed to read multipart upload: %v", err)
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "Failed to read upload",
+			})
+			return
+		}
+		if part.FormName() == "sha256" {
+			value, _ := io.ReadAll(io.LimitReader(part, 256))
+			part.Close()
+			if checksum, err = parseChecksum(string(value)); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{
+					"error": "Invalid sha256 field",
+				})
+				return
+			}
+			continue
+		}
+		if part.FormName() == "relativePath" {
+			value, _ := io.ReadAll(io.LimitReader(part, 4096))
+			part.Close()
+			relativePath = string(value)
+			continue
+		}
+		if part.FormName() == "lastModified" {
+			value, _ := io.ReadAll(io.LimitReader(part, 32))
+			part.Close()
+			modTime = parseModTime(string(value))
+			continue
+		}
+		if part.FormName() != "files" || part.FileName() == "" {
+			part.Close()
 			continue
 		}
 
-		// Check if we should compress this file
-		shouldCompress := compressEnabled && IsCompressibleImage(safeName)
-
-		if shouldCompress {
-			// Read file into memory for compression
-			originalData, compResult, compErr := CompressImageFromReader(src, safeName, imageQuality)
-			src.Close()
-
-			if compErr != nil {
-				log.Printf("Compression failed for %s: %v, saving original", safeName, compErr)
-				// Fallback: save original
-				destPath := resolveUniquePath(saveDir, safeName)
-				if writeErr := os.WriteFile(destPath, originalData, 0644); writeErr != nil {
-					log.Printf("Failed to write fallback file %s: %v", destPath, writeErr)
-					continue
-				}
-				record := UploadRecord{
-					FileName:  filepath.Base(destPath),
-					Size:      int64(len(originalData)),
-					Timestamp: time.Now().Format("2006-01-02 15:04:05"),
-					SavePath:  destPath,
-				}
-				results = append(results, record)
-				fs.app.addUploadRecord(record)
-				log.Printf("File saved (compression failed, original): %s (%d bytes)", destPath, len(originalData))
-				continue
+		// Sanitize filename, keeping the folder of a folder upload
+		safeName := sanitizeFilename(part.FileName())
+		folder := ""
+		if relativePath != "" {
+			if folder, safeName, err = sanitizeRelativePath(relativePath); err != nil {
+				part.Close()
+				writeJSON(w, http.StatusBadRequest, map[string]string{
+					"error": err.Error(),
+				})
+				return
 			}
+			relativePath = ""
+		}
 
-			// Save original copy if requested
-			if keepOriginal {
-				origExt := filepath.Ext(safeName)
-				origBase := strings.TrimSuffix(safeName, origExt)
-				origName := origBase + "_original" + origExt
-				origPath := resolveUniquePath(saveDir, origName)
-				if writeErr := os.WriteFile(origPath, originalData, 0644); writeErr != nil {
-					log.Printf("Failed to save original copy %s: %v", origPath, writeErr)
-				} else {
-					log.Printf("Original copy saved: %s (%d bytes)", origPath, len(originalData))
-				}
+		// The size limit applies to each file, not to the whole request
+		h := sha256.New()
+		tmpPath, err := receiveToTemp(saveDir, io.TeeReader(http.MaxBytesReader(w, part, maxUploadSize), h))
+		part.Close()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+					"error": fmt.Sprintf("%s is too large (max 2GB)", safeName),
+				})
+				return
 			}
+			log.Printf("Failed to receive %s: %v", safeName, err)
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "Upload interrupted",
+			})
+			return
+		}
 
-			// Determine output filename (extension may change for webp->jpg)
-			outName := safeName
-			if compResult.DidCompress {
-				origExt := filepath.Ext(safeName)
-				if strings.ToLower(origExt) != compResult.Extension {
-					outName = strings.TrimSuffix(safeName, origExt) + compResult.Extension
-				}
-			}
+		sum, err := verifyChecksum(h, checksum)
+		checksum = ""
+		if err != nil {
+			log.Printf("Rejecting %s: %v", safeName, err)
+			os.Remove(tmpPath)
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": fmt.Sprintf("%s was corrupted in transfer (checksum mismatch). Please send it again.", safeName),
+			})
+			return
+		}
 
-			destPath := resolveUniquePath(saveDir, outName)
-			dataToWrite := compResult.Data
+		received++
+		meta := uploadMeta{Name: safeName, Device: device, SHA256: sum, Conflict: conflict, ModTime: modTime, Folder: folder}
+		modTime = time.Time{}
+		record, err := fs.storeUpload(saveDir, meta, tmpPath)
+		if rejection, ok := asRejected(err); ok {
+			rejected = append(rejected, rejection)
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to store %s: %v", safeName, err)
+			continue
+		}
+		results = append(results, record)
+	}
 
-			if writeErr := os.WriteFile(destPath, dataToWrite, 0644); writeErr != nil {
-				log.Printf("Failed to write compressed file %s: %v", destPath, writeErr)
-				continue
-			}
+	if received == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "No files uploaded",
+		})
+		return
+	}
 
-			record := UploadRecord{
-				FileName:     filepath.Base(destPath),
-				Size:         int64(len(dataToWrite)),
-				Timestamp:    time.Now().Format("2006-01-02 15:04:05"),
-				SavePath:     destPath,
-				Compressed:   compResult.DidCompress,
-				OriginalSize: compResult.OriginalSize,
-			}
-			results = append(results, record)
-			fs.app.addUploadRecord(record)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"count":    len(results),
+		"files":    results,
+		"tree":     buildUploadTree(results),
+		"rejected": rejected,
+	})
+}
 
-			if compResult.DidCompress {
-				log.Printf("File saved (compressed): %s (%d bytes → %d bytes)", destPath, compResult.OriginalSize, compResult.NewSize)
-			} else {
-				log.Printf("File saved (no size reduction): %s (%d bytes)", destPath, len(dataToWrite))
-			}
-		} else {
-			// No compression: stream copy as before
-			destPath := resolveUniquePath(saveDir, safeName)
-
-			dst, err := os.Create(destPath)
-			if err != nil {
-				src.Close()
-				log.Printf("Failed to create file %s: %v", destPath, err)
-				continue
-			}
+// compressImages reports whether image compression applies to an upload,
+// taking the override of its upload rule into account
+func (fs *FileServer) compressImages(meta uploadMeta) bool {
+	switch meta.Compress {
+	case compressOn:
+		return true
+	case compressOff:
+		return false
+	}
+	return fs.app.settings().CompressImages
+}
 
-			written, err := io.Copy(dst, src)
-			src.Close()
-			dst.Close()
+// shouldCompress reports whether a file should go through the compression pipeline
+func (fs *FileServer) shouldCompress(meta uploadMeta) bool {
+	cfg := fs.app.settings()
+	if IsHEIC(meta.Name) {
+		return cfg.ConvertHEIC || (fs.compressImages(meta) && cfg.HEICOutput == heicOutputJPEG)
+	}
+	return fs.compressImages(meta) && IsCompressibleImage(meta.Name)
+}
 
-			if err != nil {
-				log.Printf("Failed to write file %s: %v", destPath, err)
-				os.Remove(destPath)
-				continue
-			}
+// compressOptions returns the compression options from the config
+func (fs *FileServer) compressOptions() CompressOptions {
+	cfg := fs.app.settings()
+	return CompressOptions{
+		Quality:           cfg.ImageQuality,
+		MaxDimension:      cfg.MaxDimension,
+		Format:            cfg.OutputFormat,
+		PNGToWebPLossless: cfg.PNGToWebP,
+	}
+}
+
+// shouldStripMetadata reports whether privacy mode applies to a file
+func (fs *FileServer) shouldStripMetadata(name string) bool {
+	return fs.app.settings().PrivacyMode && IsCompressibleImage(name)
+}
 
-			record := UploadRecord{
-				FileName:  filepath.Base(destPath),
-				Size:      written,
-				Timestamp: time.Now().Format("2006-01-02 15:04:05"),
-				SavePath:  destPath,
+// stripMetadata removes private metadata from data when privacy mode is on
+func (fs *FileServer) stripMetadata(data []byte, name string) ([]byte, bool) {
+	if !fs.shouldStripMetadata(name) {
+		return data, false
+	}
+	return stripPrivateMetadata(data, strings.ToLower(filepath.Ext(name)))
+}
+
+// storeUpload saves the received file at tmpPath and records it in the
+// upload history. In order, it checks the content type against the type
+// lists, applies the upload rules, picks the rename template, sorts the file
+// into a date folder, checks for duplicates, and then queues images for
+// compression or saves the file right away. Refused files return a
+// *rejectedError and queued images come back with Status "queued". tmpPath
+// must be on the same volume as saveDir and is always consumed.
+func (fs *FileServer) storeUpload(saveDir string, meta uploadMeta, tmpPath string) (UploadRecord, error) {
+	meta, err := fs.checkContentType(meta, tmpPath)
+	if err != nil {
+		log.Printf("Rejected %s: %v", meta.Name, err)
+		os.Remove(tmpPath)
+		return UploadRecord{}, err
+	}
+	saveDir, meta, tmpPath, err = fs.routeByRules(saveDir, meta, tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return UploadRecord{}, err
+	}
+	cfg := fs.app.settings()
+	if meta.RenameTemplate == "" {
+		meta.RenameTemplate = cfg.RenameTemplate
+	}
+	if cfg.FolderTemplate != "" || strings.Contains(meta.RenameTemplate, "{date}") || strings.Contains(meta.RenameTemplate, "{time}") {
+		meta.Date = uploadDate(meta, tmpPath)
+	}
+	meta = fs.routeByDate(meta)
+	if record, ok := fs.checkDuplicate(saveDir, meta, tmpPath); ok {
+		return record, nil
+	}
+	if fs.shouldCompress(meta) {
+		if st, err := os.Stat(tmpPath); err == nil && st.Size() <= maxCompressSize {
+			if record, ok := fs.queueCompression(saveDir, meta, tmpPath); ok {
+				return record, nil
 			}
-			results = append(results, record)
-			fs.app.addUploadRecord(record)
+		}
+	}
+	return fs.saveUpload(saveDir, meta, tmpPath)
+}
+
+// saveUpload does the work of storeUpload right away
+func (fs *FileServer) saveUpload(saveDir string, meta uploadMeta, tmpPath string) (UploadRecord, error) {
+	// A no-op once the file has been renamed into place
+	defer os.Remove(tmpPath)
 
-			log.Printf("File saved: %s (%d bytes)", destPath, written)
+	safeName := meta.Name
+	st, err := os.Stat(tmpPath)
+	if err != nil {
+		return UploadRecord{}, err
+	}
+
+	if fs.shouldCompress(meta) && st.Size() > maxCompressSize {
+		log.Printf("Skipping compression for %s: %d bytes is over the %d byte limit", safeName, st.Size(), int64(maxCompressSize))
+	} else if fs.shouldCompress(meta) {
+		record, err := fs.storeCompressed(saveDir, meta, tmpPath)
+		if err == nil {
+			return record, nil
 		}
+		log.Printf("Compression failed for %s: %v, saving original", safeName, err)
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"count":   len(results),
-		"files":   results,
-	})
+	// Privacy mode: rewrite only the metadata, in the temp file
+	stripped := false
+	if fs.shouldStripMetadata(safeName) {
+		if stripped, err = fs.stripFile(tmpPath, safeName); err != nil {
+			return UploadRecord{}, err
+		}
+	}
+
+	destPath, action, err := fs.placeUpload(tmpPath, saveDir, safeName, meta)
+	if err != nil {
+		return UploadRecord{}, err
+	}
+	if action == actionSkipped {
+		log.Printf("Skipped %s: %s already exists", safeName, destPath)
+		return fs.recordSkipped(destPath, meta), nil
+	}
+	if st, err = os.Stat(destPath); err != nil {
+		return UploadRecord{}, err
+	}
+
+	record := UploadRecord{
+		FileName:         filepath.Base(destPath),
+		Size:             st.Size(),
+		Timestamp:        time.Now().Format("2006-01-02 15:04:05"),
+		SavePath:         destPath,
+		Device:           meta.Device,
+		SHA256:           meta.SHA256,
+		MetadataStripped: stripped,
+		ConflictAction:   action,
+		Folder:           meta.Folder,
+		Rule:             meta.Rule,
+		ContentType:      meta.ContentType,
+		ExtMismatch:      meta.ExtMismatch,
+	}
+	fs.app.addUploadRecord(record)
+	fs.dupes.Add(saveDir, destPath, meta.SHA256, stripped)
+
+	log.Printf("File saved: %s (%d bytes)", destPath, st.Size())
+	return record, nil
+}
+
+// storeCompressed compresses the image at tmpPath and saves the result,
+// keeping an original copy when enabled. On error nothing has been saved.
+func (fs *FileServer) storeCompressed(saveDir string, meta uploadMeta, tmpPath string) (UploadRecord, error) {
+	safeName := meta.Name
+	originalData, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return UploadRecord{}, err
+	}
+	compResult, err := CompressImage(originalData, safeName, fs.compressOptions())
+	if err != nil {
+		return UploadRecord{}, err
+	}
+
+	// Determine output filename (extension may change for webp/heic->jpg)
+	outName := safeName
+	if compResult.DidCompress {
+		origExt := filepath.Ext(safeName)
+		if strings.ToLower(origExt) != compResult.Extension {
+			outName = strings.TrimSuffix(safeName, origExt) + compResult.Extension
+		}
+	}
+
+	dataToWrite, stripped := fs.stripMetadata(compResult.Data, outName)
+	destPath, action, err := fs.writeUpload(saveDir, outName, dataToWrite, meta)
+	if err != nil {
+		return UploadRecord{}, fmt.Errorf("failed to write compressed file: %w", err)
+	}
+	if action == actionSkipped {
+		log.Printf("Skipped %s: %s already exists", safeName, destPath)
+		return fs.recordSkipped(destPath, meta), nil
+	}
+
+	// Save original copy if requested, named after the saved file
+	if fs.app.settings().KeepOriginal {
+		origExt := filepath.Ext(safeName)
+		saved := filepath.Base(destPath)
+		origName := strings.TrimSuffix(saved, filepath.Ext(saved)) + "_original" + origExt
+		origData, _ := fs.stripMetadata(originalData, safeName)
+		origMeta := meta
+		origMeta.RenameTemplate = ""
+		if origPath, action, err := fs.writeUpload(saveDir, origName, origData, origMeta); err != nil {
+			log.Printf("Failed to save original copy of %s: %v", safeName, err)
+		} else if action != actionSkipped {
+			log.Printf("Original copy saved: %s (%d bytes)", origPath, len(origData))
+		}
+	}
+
+	record := UploadRecord{
+		FileName:         filepath.Base(destPath),
+		Size:             int64(len(dataToWrite)),
+		Timestamp:        time.Now().Format("2006-01-02 15:04:05"),
+		SavePath:         destPath,
+		Compressed:       compResult.DidCompress,
+		OriginalSize:     compResult.OriginalSize,
+		Device:           meta.Device,
+		SHA256:           meta.SHA256,
+		MetadataStripped: stripped,
+		ConflictAction:   action,
+		Folder:           meta.Folder,
+		Rule:             meta.Rule,
+		ContentType:      meta.ContentType,
+		ExtMismatch:      meta.ExtMismatch,
+	}
+	fs.app.addUploadRecord(record)
+	fs.dupes.Add(saveDir, destPath, meta.SHA256, compResult.DidCompress || stripped)
+
+	if compResult.DidCompress {
+		log.Printf("File saved (compressed): %s (%d bytes → %d bytes)", destPath, compResult.OriginalSize, compResult.NewSize)
+	} else {
+		log.Printf("File saved (no size reduction): %s (%d bytes)", destPath, len(dataToWrite))
+	}
+	return record, nil
+}
+
+// stripFile removes private metadata from the file at path in place. Only
+// the metadata is read into memory, so uploads of any size are covered.
+func (fs *FileServer) stripFile(path, name string) (bool, error) {
+	stripped, err := stripPrivateMetadataFile(path, strings.ToLower(filepath.Ext(name)))
+	if err != nil {
+		return false, fmt.Errorf("failed to rewrite %s: %w", name, err)
+	}
+	return stripped, nil
 }
 
+// receiveToTemp streams src into a new temp file in the staging directory
+// and returns its path. The temp file is removed on error.
+func receiveToTemp(saveDir string, src io.Reader) (string, error) {
+	if err := os.MkdirAll(stagingDir(saveDir), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(stagingDir(saveDir), "upload-*"+tempUploadSuffix)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(f, src)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// writeUpload writes data to a temp file and moves it into saveDir under name
+func (fs *FileServer) writeUpload(saveDir, name string, data []byte, meta uploadMeta) (string, string, error) {
+	tmpPath, err := receiveToTemp(saveDir, bytes.NewReader(data))
+	if err != nil {
+		return "", "", err
+	}
+	destPath, action, err := fs.placeUpload(tmpPath, saveDir, name, meta)
+	if err != nil || action == actionSkipped {
+		os.Remove(tmpPath)
+	}
+	return destPath, action, err
+}
+
+// placeUpload renames a finished temp file into saveDir under name, applying
+// the conflict policy. Returns the path and the conflict action taken; on
+// actionSkipped the temp file is left for the caller to remove. Readers of
+// the save directory never see a partly written file.
+func (fs *FileServer) placeUpload(tmpPath, saveDir, name string, meta uploadMeta) (string, string, error) {
+	// Hold the lock so two uploads with the same name cannot pick the same path
+	fs.placeMu.Lock()
+	defer fs.placeMu.Unlock()
+
+	destDir, err := uploadDir(saveDir, meta)
+	if err != nil {
+		return "", "", err
+	}
+	name = renameUpload(destDir, name, meta, tmpPath)
+	policy := fs.conflictPolicy(meta)
+	destPath, action := resolveDestPath(destDir, name, policy, meta.ModTime)
+	if action == actionSkipped {
+		return destPath, action, nil
+	}
+	if action == actionOverwritten {
+		fs.dupes.Forget(destPath)
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return "", "", fmt.Errorf("failed to move %s into place: %w", name, err)
+	}
+	if !meta.ModTime.IsZero() {
+		// Keep the phone's modification time, which "newer" compares against
+		if err := os.Chtimes(destPath, meta.ModTime, meta.ModTime); err != nil {
+			log.Printf("Failed to set the modification time of %s: %v", destPath, err)
+		}
+	}
+	return destPath, action, nil
+}
+
+// uploadDir returns the directory an upload is saved in, creating the
+// folder of a folder upload
+func uploadDir(saveDir string, meta uploadMeta) (string, error) {
+	if meta.Folder == "" {
+		return saveDir, nil
+	}
+	dir := filepath.Join(saveDir, filepath.FromSlash(meta.Folder))
+	if !withinDir(dir, saveDir) {
+		return "", fmt.Errorf("folder %q is outside the save directory", meta.Folder)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create folder %s: %w", meta.Folder, err)
+	}
+	return dir, nil
+}
+
+// maxFolderDepth limits how deeply a folder upload may nest
+const maxFolderDepth = 32
+
+// sanitizeRelativePath splits a relative path sent with a folder upload, such
+// as "Trip/Day 1/IMG_0001.jpg", into a sanitized "/"-separated folder and file
+// name. Absolute paths and "." or ".." segments are rejected.
+func sanitizeRelativePath(p string) (folder, name string, err error) {
+	segments := strings.Split(strings.ReplaceAll(p, "\\", "/"), "/")
+	if len(segments) > maxFolderDepth+1 {
+		return "", "", fmt.Errorf("path is nested too deeply")
+	}
+	for i, seg := range segments {
+		if seg == "" || seg == "." || seg == ".." {
+			return "", "", fmt.Errorf("invalid path %q", p)
+		}
+		segments[i] = sanitizeFilename(seg)
+	}
+	last := len(segments) - 1
+	return strings.Join(segments[:last], "/"), segments[last], nil
+}
+
+// uploadTree is one folder in the layout of the files saved by a request
+type uploadTree struct {
+	Name    string        `json:"name"`
+	Files   []string      `json:"files,omitempty"`
+	Folders []*uploadTree `json:"folders,omitempty"`
+}
+
+// buildUploadTree arranges records by folder, rooted at the save directory
+func buildUploadTree(records []UploadRecord) *uploadTree {
+	root := &uploadTree{}
+	for _, r := range records {
+		node := root
+		if r.Folder != "" {
+			for _, name := range strings.Split(r.Folder, "/") {
+				var child *uploadTree
+				for _, f := range node.Folders {
+					if f.Name == name {
+						child = f
+						break
+					}
+				}
+				if child == nil {
+					child = &uploadTree{Name: name}
+					node.Folders = append(node.Folders, child)
+				}
+				node = child
+			}
+		}
+		node.Files = append(node.Files, r.FileName)
+	}
+	return root
+}
+
+// unsafeFilenameChars matches characters that are not allowed in file names
+// on Windows, or are path separators or control characters elsewhere
+var unsafeFilenameChars = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
+
 // sanitizeFilename removes dangerous characters and path traversal attempts
 func sanitizeFilename(name string) string {
 	// Get only the base name (prevent path traversal)
@@ -284,8 +769,7 @@ func sanitizeFilename(name string) string {
 	name = strings.ReplaceAll(name, "\x00", "")
 
 	// Replace dangerous characters
-	re := regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
-	name = re.ReplaceAllString(name, "_")
+	name = unsafeFilenameChars.ReplaceAllString(name, "_")
 
 	// Remove leading/trailing dots and spaces
 	name = strings.Trim(name, ". ")
@@ -366,9 +850,11 @@ body {
 h1 {
   font-size: 1.5rem;
   text-align: center;
-  margin-bottom: 24px;
+  margin-bottom: 8px;
   color: #38bdf8;
 }
+.nav { text-align: center; margin-bottom: 24px; font-size: 0.9rem; }
+.nav a { color: #94a3b8; }
 .upload-area {
   border: 2px dashed #475569;
   border-radius: 12px;
@@ -395,6 +881,8 @@ h1 {
 .file-input-label:active {
   background: #1d4ed8;
 }
+.folder-label { background: #334155; }
+.folder-label:active { background: #1e293b; }
 input[type="file"] { display: none; }
 .file-list {
   margin: 16px 0;
@@ -471,20 +959,88 @@ input[type="file"] { display: none; }
 .status.success { color: #4ade80; }
 .status.error { color: #f87171; }
 .status.uploading { color: #38bdf8; }
+.text-section {
+  margin-top: 32px;
+  border-top: 1px solid #334155;
+  padding-top: 20px;
+}
+.text-section h2 {
+  font-size: 1rem;
+  color: #94a3b8;
+  margin-bottom: 10px;
+}
+.text-section textarea {
+  width: 100%;
+  min-height: 80px;
+  padding: 10px;
+  border-radius: 8px;
+  border: 1px solid #475569;
+  background: #1e293b;
+  color: #e2e8f0;
+  font-size: 1rem;
+  font-family: inherit;
+  margin-bottom: 8px;
+}
+.text-btn {
+  display: block;
+  width: 100%;
+  padding: 12px;
+  background: #2563eb;
+  color: white;
+  border: none;
+  border-radius: 8px;
+  font-size: 1rem;
+  -webkit-tap-highlight-color: transparent;
+}
+.text-item {
+  background: #1e293b;
+  border-radius: 8px;
+  padding: 10px 14px;
+  margin-bottom: 8px;
+  font-size: 0.9rem;
+}
+.text-item pre {
+  white-space: pre-wrap;
+  word-break: break-all;
+  font-family: inherit;
+  margin-bottom: 6px;
+  -webkit-user-select: text;
+  user-select: text;
+}
+.text-item button {
+  background: #334155;
+  color: #e2e8f0;
+  border: none;
+  border-radius: 6px;
+  padding: 4px 12px;
+  font-size: 0.8rem;
+}
 </style>
 </head>
 <body>
 <div class="container">
   <h1>{{.Heading}}</h1>
+  <div class="nav"><a href="/download?lang={{.Lang}}">{{.FromPC}}</a></div>
   <div class="upload-area" id="uploadArea">
     <label class="file-input-label" for="fileInput">{{.SelectFiles}}</label>
     <input type="file" id="fileInput" multiple accept="*/*">
+    <label class="file-input-label folder-label" for="folderInput" id="folderLabel" style="display:none">{{.SelectFolder}}</label>
+    <input type="file" id="folderInput" multiple webkitdirectory>
     <p style="color:#94a3b8; margin-top:8px; font-size:0.85rem;">{{.FileHint}}</p>
   </div>
   <div class="file-list" id="fileList"></div>
   <div class="progress-bar" id="progressBar"><div class="fill" id="progressFill"></div></div>
   <div class="status" id="status"></div>
   <button class="send-btn" id="sendBtn" disabled>{{.UploadBtn}}</button>
+
+  <div class="text-section">
+    <h2>{{.SendText}}</h2>
+    <textarea id="textInput"></textarea>
+    <button class="text-btn" id="textBtn">{{.SendTextBtn}}</button>
+    <div class="status" id="textStatus"></div>
+    <h2>{{.TextFromPC}}</h2>
+    <div id="textList"></div>
+  </div>
 </div>
 
 <script>
@@ -494,10 +1050,28 @@ var T = {
   successSuffix: '{{.SuccessSuffix}}',
   uploadFailed: '{{.UploadFailed}}',
   networkError: '{{.NetworkError}}',
-  cancelled: '{{.Cancelled}}'
+  cancelled: '{{.Cancelled}}',
+  reconnecting: '{{.Reconnecting}}',
+  checking: '{{.Checking}}',
+  duplicates: '{{.Duplicates}}',
+  rejected: '{{.Rejected}}',
+  awaitApproval: '{{.AwaitApproval}}',
+  textSent: '{{.TextSent}}',
+  copy: '{{.Copy}}',
+  copied: '{{.Copied}}'
 };
 
+// Chunk size for resumable uploads
+var CHUNK_SIZE = 8 * 1024 * 1024;
+// Delay between reconnect attempts (ms), grows up to RETRY_MAX
+var RETRY_MIN = 1000;
+var RETRY_MAX = 15000;
+// Largest file hashed before upload. WebCrypto cannot hash incrementally,
+// so the whole file is read into memory.
+var MAX_HASH_SIZE = 512 * 1024 * 1024;
+
 var fileInput = document.getElementById('fileInput');
+var folderInput = document.getElementById('folderInput');
 var fileList = document.getElementById('fileList');
 var sendBtn = document.getElementById('sendBtn');
 var statusEl = document.getElementById('status');
@@ -506,12 +1080,22 @@ var progressFill = document.getElementById('progressFill');
 
 var selectedFiles = [];
 
-fileInput.addEventListener('change', function() {
+// Folder picking is not available on every phone (e.g. older iOS)
+if ('webkitdirectory' in folderInput) {
+  document.getElementById('folderLabel').style.display = 'inline-block';
+}
+
+// relativePath is the path of a file inside a picked folder, or just its name
+function relativePath(f) {
+  return f.webkitRelativePath || f.name;
+}
+
+function addFiles() {
   var newFiles = Array.from(this.files);
   var existingNames = {};
-  selectedFiles.forEach(function(f) { existingNames[f.name + '_' + f.size] = true; });
+  selectedFiles.forEach(function(f) { existingNames[relativePath(f) + '_' + f.size] = true; });
   newFiles.forEach(function(f) {
-    if (!existingNames[f.name + '_' + f.size]) {
+    if (!existingNames[relativePath(f) + '_' + f.size]) {
       selectedFiles.push(f);
     }
   });
@@ -520,7 +1104,10 @@ fileInput.addEventListener('change', function() {
   sendBtn.disabled = selectedFiles.length === 0;
   statusEl.textContent = '';
   statusEl.className = 'status';
-});
+}
+
+fileInput.addEventListener('change', addFiles);
+folderInput.addEventListener('change', addFiles);
 
 function renderFileList() {
   fileList.innerHTML = '';
@@ -529,7 +1116,7 @@ function renderFileList() {
     div.className = 'file-item';
     var nameSpan = document.createElement('span');
     nameSpan.className = 'name';
-    nameSpan.textContent = f.name;
+    nameSpan.textContent = relativePath(f);
     var sizeSpan = document.createElement('span');
     sizeSpan.className = 'size';
     sizeSpan.textContent = formatSize(f.size);
@@ -552,60 +1139,315 @@ function renderFileList() {
 sendBtn.addEventListener('click', function() {
   if (selectedFiles.length === 0) return;
 
-  var formData = new FormData();
-  selectedFiles.forEach(function(f) { formData.append('files', f); });
-
-  var xhr = new XMLHttpRequest();
-  xhr.open('POST', '/api/upload');
+  var files = selectedFiles.slice();
+  var totalBytes = files.reduce(function(sum, f) { return sum + f.size; }, 0);
+  var doneBytes = 0;
+  var count = 0;
+  var skipped = [];
+  var rejected = [];
 
-  xhr.upload.addEventListener('progress', function(e) {
-    if (e.lengthComputable) {
-      var pct = Math.round((e.loaded / e.total) * 100);
-      progressFill.style.width = pct + '%';
-      statusEl.textContent = T.uploadingPct + pct + '%';
-      statusEl.className = 'status uploading';
-    }
-  });
+  progressBar.style.display = 'block';
+  progressFill.style.width = '0%';
+  statusEl.textContent = T.uploading;
+  statusEl.className = 'status uploading';
+  sendBtn.disabled = true;
 
-  xhr.addEventListener('load', function() {
-    progressBar.style.display = 'none';
-    if (xhr.status === 200) {
-      var res = JSON.parse(xhr.responseText);
-      statusEl.textContent = res.count + T.successSuffix;
-      statusEl.className = 'status success';
+  function showProgress(bytes) {
+    var pct = totalBytes > 0 ? Math.round(((doneBytes + bytes) / totalBytes) * 100) : 100;
+    progressFill.style.width = pct + '%';
+    statusEl.textContent = T.uploadingPct + pct + '%';
+    statusEl.className = 'status uploading';
+  }
+
+  function next(i) {
+    if (i >= files.length) {
+      progressBar.style.display = 'none';
+      statusEl.textContent = count + T.successSuffix;
+      if (skipped.length > 0) {
+        statusEl.textContent += ' ' + T.duplicates + skipped.join(', ');
+      }
+      if (rejected.length > 0) {
+        statusEl.textContent += ' ' + T.rejected + rejected.join(', ');
+      }
+      statusEl.className = rejected.length > 0 ? 'status error' : 'status success';
       selectedFiles = [];
       fileList.innerHTML = '';
       fileInput.value = '';
       sendBtn.disabled = true;
-    } else {
-      var msg = T.uploadFailed;
-      try { msg = JSON.parse(xhr.responseText).error || msg; } catch(e) {}
-      statusEl.textContent = msg;
-      statusEl.className = 'status error';
+      return;
     }
-  });
+    uploadResumable(files[i], showProgress, function(err, record) {
+      if (err) {
+        progressBar.style.display = 'none';
+        statusEl.textContent = err;
+        statusEl.className = 'status error';
+        sendBtn.disabled = false;
+        return;
+      }
+      doneBytes += files[i].size;
+      if (record && record.status === 'rejected') {
+        rejected.push(relativePath(files[i]) + ' (' + record.contentType + ')');
+      } else if (record && (record.status === 'duplicate' || record.conflictAction === 'skipped')) {
+        skipped.push(relativePath(files[i]));
+      } else {
+        count++;
+      }
+      next(i + 1);
+    });
+  }
 
-  xhr.addEventListener('error', function() {
-    progressBar.style.display = 'none';
-    statusEl.textContent = T.networkError;
-    statusEl.className = 'status error';
-  });
+  next(0);
+});
 
-  xhr.addEventListener('abort', function() {
-    progressBar.style.display = 'none';
-    statusEl.textContent = T.cancelled;
-    statusEl.className = 'status error';
-  });
+// fingerprint identifies a file across page reloads so an upload can be resumed
+function fingerprint(f) {
+  return 'fb-upload:' + relativePath(f) + ':' + f.size + ':' + (f.lastModified || 0);
+}
 
-  progressBar.style.display = 'block';
-  progressFill.style.width = '0%';
-  statusEl.textContent = T.uploading;
-  statusEl.className = 'status uploading';
-  sendBtn.disabled = true;
+function storedLocation(f) {
+  try { return localStorage.getItem(fingerprint(f)); } catch(e) { return null; }
+}
+
+function storeLocation(f, loc) {
+  try {
+    if (loc) localStorage.setItem(fingerprint(f), loc);
+    else localStorage.removeItem(fingerprint(f));
+  } catch(e) {}
+}
+
+function b64(s) {
+  return btoa(unescape(encodeURIComponent(s)));
+}
+
+// sha256 resolves to the hex SHA-256 of a file, or '' where WebCrypto is
+// unavailable (it needs HTTPS) or the file is too large to hash
+function sha256(file) {
+  if (!window.crypto || !crypto.subtle || !file.arrayBuffer || file.size > MAX_HASH_SIZE) {
+    return Promise.resolve('');
+  }
+  return file.arrayBuffer().then(function(buf) {
+    return crypto.subtle.digest('SHA-256', buf);
+  }).then(function(digest) {
+    return Array.from(new Uint8Array(digest)).map(function(b) {
+      return ('0' + b.toString(16)).slice(-2);
+    }).join('');
+  }).catch(function() { return ''; });
+}
+
+function errorMessage(xhr) {
+  var msg = T.uploadFailed;
+  try { msg = JSON.parse(xhr.responseText).error || msg; } catch(e) {}
+  return msg;
+}
 
-  xhr.send(formData);
+// uploadResumable sends one file in chunks. Network failures are retried
+// forever with backoff: the server is asked for its offset (HEAD) and the
+// upload continues from there. Calls done(null, record) on success or done(msg).
+function uploadResumable(file, onProgress, done) {
+  var location = storedLocation(file);
+  var offset = 0;
+  var delay = RETRY_MIN;
+  var checksum = null;
+
+  function retry() {
+    statusEl.textContent = T.reconnecting;
+    statusEl.className = 'status error';
+    var fired = false;
+    function go() {
+      if (fired) return;
+      fired = true;
+      clearTimeout(timer);
+      window.removeEventListener('online', go);
+      resume();
+    }
+    var timer = setTimeout(go, delay);
+    delay = Math.min(delay * 2, RETRY_MAX);
+    window.addEventListener('online', go);
+  }
+
+  function create() {
+    if (checksum === null) {
+      // The server checks the received bytes against this hash
+      statusEl.textContent = T.checking;
+      statusEl.className = 'status uploading';
+      sha256(file).then(function(sum) {
+        checksum = sum;
+        create();
+      });
+      return;
+    }
+    var meta = 'filename ' + b64(file.name);
+    if (checksum) meta += ',sha256 ' + b64(checksum);
+    if (file.lastModified) meta += ',lastModified ' + b64(String(file.lastModified));
+    if (file.webkitRelativePath) meta += ',relativePath ' + b64(file.webkitRelativePath);
+    var xhr = new XMLHttpRequest();
+    xhr.open('POST', '/api/uploads');
+    xhr.setRequestHeader('Upload-Length', String(file.size));
+    xhr.setRequestHeader('Upload-Metadata', meta);
+    // The PC may hold the request while it asks whether to accept this device
+    var approvalTimer = setTimeout(function() {
+      statusEl.textContent = T.awaitApproval;
+      statusEl.className = 'status uploading';
+    }, 1500);
+    xhr.onloadend = function() { clearTimeout(approvalTimer); };
+    xhr.onload = function() {
+      if (xhr.status !== 201) { done(errorMessage(xhr)); return; }
+      location = xhr.getResponseHeader('Location');
+      storeLocation(file, location);
+      offset = 0;
+      send();
+    };
+    xhr.onerror = retry;
+    xhr.send();
+  }
+
+  function resume() {
+    if (!location) { create(); return; }
+    var xhr = new XMLHttpRequest();
+    xhr.open('HEAD', location);
+    xhr.onload = function() {
+      if (xhr.status === 404) {
+        // Upload expired or already finished elsewhere; start over
+        storeLocation(file, null);
+        location = null;
+        create();
+        return;
+      }
+      if (xhr.status !== 200) { retry(); return; }
+      offset = parseInt(xhr.getResponseHeader('Upload-Offset'), 10) || 0;
+      send();
+    };
+    xhr.onerror = retry;
+    xhr.send();
+  }
+
+  function send() {
+    var end = Math.min(offset + CHUNK_SIZE, file.size);
+    var xhr = new XMLHttpRequest();
+    xhr.open('PATCH', location);
+    xhr.setRequestHeader('Upload-Offset', String(offset));
+    xhr.setRequestHeader('Content-Type', 'application/offset+octet-stream');
+    xhr.upload.onprogress = function(e) {
+      if (e.lengthComputable) onProgress(offset + e.loaded);
+    };
+    xhr.onload = function() {
+      if (xhr.status === 204) {
+        delay = RETRY_MIN;
+        offset = parseInt(xhr.getResponseHeader('Upload-Offset'), 10) || end;
+        onProgress(offset);
+        send();
+      } else if (xhr.status === 200) {
+        storeLocation(file, null);
+        onProgress(file.size);
+        var record = null;
+        try { record = JSON.parse(xhr.responseText).file; } catch(e) {}
+        done(null, record);
+      } else if (xhr.status === 415) {
+        // Refused by the PC's file type lists; go on with the other files
+        storeLocation(file, null);
+        var rejection = { status: 'rejected', contentType: '' };
+        try { rejection.contentType = JSON.parse(xhr.responseText).rejected.contentType; } catch(e) {}
+        done(null, rejection);
+      } else if (xhr.status === 409 || xhr.status === 423 || xhr.status >= 500) {
+        // Offset out of sync, previous request still draining, or an interrupted chunk
+        retry();
+      } else {
+        storeLocation(file, null);
+        done(errorMessage(xhr));
+      }
+    };
+    xhr.onerror = retry;
+    xhr.onabort = function() { done(T.cancelled); };
+    xhr.send(file.slice(offset, end));
+  }
+
+  resume();
+}
+
+// Text channel: phone → PC by POST, PC → phone by event stream (polling fallback)
+var textInput = document.getElementById('textInput');
+var textBtn = document.getElementById('textBtn');
+var textStatus = document.getElementById('textStatus');
+var textList = document.getElementById('textList');
+var lastTextId = 0;
+
+textBtn.addEventListener('click', function() {
+  var text = textInput.value;
+  if (!text.trim()) return;
+  textBtn.disabled = true;
+  var xhr = new XMLHttpRequest();
+  xhr.open('POST', '/api/text');
+  xhr.setRequestHeader('Content-Type', 'application/json');
+  xhr.onload = function() {
+    textBtn.disabled = false;
+    if (xhr.status === 200) {
+      textInput.value = '';
+      textStatus.textContent = T.textSent;
+      textStatus.className = 'status success';
+    } else {
+      textStatus.textContent = errorMessage(xhr);
+      textStatus.className = 'status error';
+    }
+  };
+  xhr.onerror = function() {
+    textBtn.disabled = false;
+    textStatus.textContent = T.networkError;
+    textStatus.className = 'status error';
+  };
+  xhr.send(JSON.stringify({ text: text }));
 });
 
+function copyText(text, btn) {
+  function done() { btn.textContent = T.copied; }
+  if (navigator.clipboard && window.isSecureContext) {
+    navigator.clipboard.writeText(text).then(done);
+    return;
+  }
+  // Clipboard API needs HTTPS; fall back to a temporary textarea
+  var ta = document.createElement('textarea');
+  ta.value = text;
+  document.body.appendChild(ta);
+  ta.select();
+  try { document.execCommand('copy'); done(); } catch(e) {}
+  document.body.removeChild(ta);
+}
+
+function showText(msg) {
+  if (msg.id <= lastTextId) return;
+  lastTextId = msg.id;
+  var div = document.createElement('div');
+  div.className = 'text-item';
+  var pre = document.createElement('pre');
+  pre.textContent = msg.text;
+  var btn = document.createElement('button');
+  btn.textContent = T.copy;
+  btn.addEventListener('click', function() { copyText(msg.text, btn); });
+  div.appendChild(pre);
+  div.appendChild(btn);
+  textList.insertBefore(div, textList.firstChild);
+}
+
+function pollText() {
+  var xhr = new XMLHttpRequest();
+  xhr.open('GET', '/api/text?after=' + lastTextId);
+  xhr.onload = function() {
+    if (xhr.status === 200) {
+      JSON.parse(xhr.responseText).messages.forEach(showText);
+    }
+  };
+  xhr.send();
+}
+
+pollText();
+if (window.EventSource) {
+  var stream = new EventSource('/api/text/stream');
+  stream.onmessage = function(e) { showText(JSON.parse(e.data)); };
+  // EventSource reconnects by itself; catch up on anything missed meanwhile
+  stream.onopen = pollText;
+} else {
+  setInterval(pollText, 5000);
+}
+
 function formatSize(bytes) {
   if (bytes < 1024) return bytes + ' B';
   if (bytes < 1024 * 1024) return (bytes / 1024).toFixed(1) + ' KB';
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeRelativePath(t *testing.T) {
+	tests := []struct {
+		path, folder, name string
+	}{
+		{"IMG_0001.jpg", "", "IMG_0001.jpg"},
+		{"Trip/Day 1/IMG_0001.jpg", "Trip/Day 1", "IMG_0001.jpg"},
+		{`Trip\Day 1\IMG_0001.jpg`, "Trip/Day 1", "IMG_0001.jpg"},
+		{"Trip/a:b?.jpg", "Trip", "a_b_.jpg"},
+		{"Trip/ .cache /a.jpg", "Trip/cache", "a.jpg"},
+		{strings.Repeat("d/", maxFolderDepth) + "a.jpg", strings.Repeat("d/", maxFolderDepth-1) + "d", "a.jpg"},
+	}
+	for _, tt := range tests {
+		folder, name, err := sanitizeRelativePath(tt.path)
+		if err != nil {
+			t.Errorf("sanitizeRelativePath(%q): %v", tt.path, err)
+			continue
+		}
+		if folder != tt.folder || name != tt.name {
+			t.Errorf("sanitizeRelativePath(%q) = %q, %q, want %q, %q", tt.path, folder, name, tt.folder, tt.name)
+		}
+	}
+}
+
+func TestSanitizeRelativePathRejects(t *testing.T) {
+	for _, p := range []string{
+		"",
+		"/etc/passwd",
+		`\Windows\a.exe`,
+		"../a.jpg",
+		"Trip/../../a.jpg",
+		"Trip/./a.jpg",
+		"Trip//a.jpg",
+		"Trip/",
+		`Trip\..\a.jpg`,
+		strings.Repeat("d/", maxFolderDepth+1) + "a.jpg",
+	} {
+		if folder, name, err := sanitizeRelativePath(p); err == nil {
+			t.Errorf("sanitizeRelativePath(%q) = %q, %q, want an error", p, folder, name)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Compression overrides a rule can set
+const (
+	compressDefault = ""    // follow the image compression setting
+	compressOn      = "on"  // compress matching images
+	compressOff     = "off" // save matching images as they are
+)
+
+// UploadRule routes uploads that match all of its conditions. Empty
+// conditions match anything; rules are tried in order and the first match wins.
+type UploadRule struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+
+	// Conditions
+	Extensions []string `json:"extensions,omitempty"` // ".mp4", ".mov"
+	MIMETypes  []string `json:"mimeTypes,omitempty"`  // sniffed from the content: "video/*", "application/pdf", "executable"
+	NameGlob   string   `json:"nameGlob,omitempty"`   // "Screenshot*", case-insensitive
+	NameRegex  string   `json:"nameRegex,omitempty"`  // `^IMG_\d+`
+	MinSize    int64    `json:"minSize,omitempty"`    // bytes
+	MaxSize    int64    `json:"maxSize,omitempty"`    // bytes, 0 = no limit
+	Device     string   `json:"device,omitempty"`     // part of the sending device's name, case-insensitive
+
+	// Actions
+	SaveDir        string `json:"saveDir,omitempty"`        // absolute directory, "" = the save directory
+	Compress       string `json:"compress,omitempty"`       // compressDefault, compressOn or compressOff
+	RenameTemplate string `json:"renameTemplate,omitempty"` // replaces the global rename template, see renameTokens
+
+	nameRegex *regexp.Regexp // NameRegex compiled by validateRule
+}
+
+// RuleMatch is the outcome of the rules for one file
+type RuleMatch struct {
+	RuleID   string `json:"ruleId,omitempty"`
+	RuleName string `json:"ruleName,omitempty"`
+	SaveDir  string `json:"saveDir"`
+	FileName string `json:"fileName"`
+	Compress bool   `json:"compress"`
+	MIMEType string `json:"mimeType,omitempty"`
+}
+
+// ruleFile is what the conditions of a rule are tested against
+type ruleFile struct {
+	name     string
+	size     int64
+	mimeType string
+	device   string
+}
+
+// newRuleID returns a random rule ID
+func newRuleID() string {
+	return hex.EncodeToString(randomBytes(8))
+}
+
+// validateRule normalizes a rule from the desktop app and checks its
+// patterns, sizes and actions
+func validateRule(r UploadRule) (UploadRule, error) {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return r, fmt.Errorf("rule name is empty")
+	}
+
+	exts := r.Extensions[:0:0]
+	for _, ext := range r.Extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+	r.Extensions = exts
+
+	types, err := parseTypeList(r.MIMETypes)
+	if err != nil {
+		return r, err
+	}
+	r.MIMETypes = types
+
+	if _, err := filepath.Match(strings.ToLower(r.NameGlob), ""); err != nil {
+		return r, fmt.Errorf("invalid name pattern %q: %w", r.NameGlob, err)
+	}
+	r.nameRegex = nil
+	if r.NameRegex != "" {
+		if r.nameRegex, err = regexp.Compile(r.NameRegex); err != nil {
+			return r, fmt.Errorf("invalid name regex %q: %w", r.NameRegex, err)
+		}
+	}
+	if r.MinSize < 0 || r.MaxSize < 0 || (r.MaxSize > 0 && r.MaxSize < r.MinSize) {
+		return r, fmt.Errorf("invalid size range")
+	}
+	r.Device = strings.TrimSpace(r.Device)
+
+	if r.SaveDir = strings.TrimSpace(r.SaveDir); r.SaveDir != "" {
+		if !filepath.IsAbs(r.SaveDir) {
+			return r, fmt.Errorf("destination must be an absolute path: %s", r.SaveDir)
+		}
+		r.SaveDir = filepath.Clean(r.SaveDir)
+	}
+	if r.Compress != compressDefault && r.Compress != compressOn && r.Compress != compressOff {
+		return r, fmt.Errorf("unknown compression setting: %s", r.Compress)
+	}
+	tmpl, err := parseRenameTemplate(r.RenameTemplate)
+	if err != nil {
+		return r, err
+	}
+	r.RenameTemplate = tmpl
+	return r, nil
+}
+
+// matches reports whether a file meets every condition of the rule
+func (r UploadRule) matches(f ruleFile) bool {
+	if !r.Enabled {
+		return false
+	}
+	if len(r.Extensions) > 0 && !containsString(r.Extensions, strings.ToLower(filepath.Ext(f.name))) {
+		return false
+	}
+	if len(r.MIMETypes) > 0 && !matchMIMEType(r.MIMETypes, f.mimeType) {
+		return false
+	}
+	if r.NameGlob != "" {
+		if ok, _ := filepath.Match(strings.ToLower(r.NameGlob), strings.ToLower(f.name)); !ok {
+			return false
+		}
+	}
+	if r.nameRegex != nil && !r.nameRegex.MatchString(f.name) {
+		return false
+	}
+	if f.size < r.MinSize || (r.MaxSize > 0 && f.size > r.MaxSize) {
+		return false
+	}
+	if r.Device != "" && !strings.Contains(strings.ToLower(f.device), strings.ToLower(r.Device)) {
+		return false
+	}
+	return true
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// baseMIMEType drops parameters such as "; charset=utf-8" from a content type
+func baseMIMEType(t string) string {
+	if i := strings.IndexByte(t, ';'); i >= 0 {
+		t = t[:i]
+	}
+	return strings.TrimSpace(t)
+}
+
+// matchRule returns the first enabled rule that matches f, or nil
+func matchRule(rules []UploadRule, f ruleFile) *UploadRule {
+	for i := range rules {
+		if rules[i].matches(f) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// applyRule returns what a rule makes of an upload: the directory it is saved
+// in and its rename template and compression setting
+func (fs *FileServer) applyRule(rule *UploadRule, saveDir string, meta uploadMeta) (string, uploadMeta) {
+	if rule == nil {
+		return saveDir, meta
+	}
+	meta.Rule = rule.Name
+	if rule.SaveDir != "" {
+		saveDir = rule.SaveDir
+	}
+	meta.Compress = rule.Compress
+	if rule.RenameTemplate != "" {
+		meta.RenameTemplate = rule.RenameTemplate
+	}
+	return saveDir, meta
+}
+
+// routeByRules applies the first matching upload rule to a received file. A
+// rule with its own destination gets the file moved to that directory's
+// staging area, so the returned temp path replaces tmpPath.
+func (fs *FileServer) routeByRules(saveDir string, meta uploadMeta, tmpPath string) (string, uploadMeta, string, error) {
+	rules := fs.app.settings().Rules
+	if len(rules) == 0 {
+		return saveDir, meta, tmpPath, nil
+	}
+	st, err := os.Stat(tmpPath)
+	if err != nil {
+		return "", meta, tmpPath, err
+	}
+
+	f := ruleFile{name: meta.Name, size: st.Size(), mimeType: meta.ContentType, device: meta.Device}
+	rule := matchRule(rules, f)
+	if rule == nil {
+		return saveDir, meta, tmpPath, nil
+	}
+	dir, meta := fs.applyRule(rule, saveDir, meta)
+	if dir == saveDir {
+		return saveDir, meta, tmpPath, nil
+	}
+
+	newPath, err := restage(tmpPath, dir)
+	if err != nil {
+		return "", meta, tmpPath, fmt.Errorf("failed to move %s to %s: %w", meta.Name, dir, err)
+	}
+	return dir, meta, newPath, nil
+}
+
+// restage moves a received file into the staging directory of another save
+// directory, copying it when that is on a different volume
+func restage(tmpPath, saveDir string) (string, error) {
+	if err := os.MkdirAll(stagingDir(saveDir), 0755); err != nil {
+		return "", err
+	}
+	cleanupStagedUploads(saveDir)
+
+	f, err := os.CreateTemp(stagingDir(saveDir), "upload-*"+tempUploadSuffix)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	if err := os.Rename(tmpPath, f.Name()); err == nil {
+		return f.Name(), nil
+	}
+	os.Remove(f.Name())
+
+	src, err := os.Open(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	newPath, err := receiveToTemp(saveDir, src)
+	src.Close()
+	if err != nil {
+		return "", err
+	}
+	os.Remove(tmpPath)
+	return newPath, nil
+}
+
+// testRules shows what the rules would do with a file, without its content.
+// The MIME type is guessed from the extension.
+func (fs *FileServer) testRules(name string, size int64, device string) RuleMatch {
+	meta := uploadMeta{Name: sanitizeFilename(name), Device: device}
+	f := ruleFile{
+		name:     meta.Name,
+		size:     size,
+		mimeType: baseMIMEType(mime.TypeByExtension(strings.ToLower(filepath.Ext(meta.Name)))),
+		device:   device,
+	}
+
+	cfg := fs.app.settings()
+	rule := matchRule(cfg.Rules, f)
+	meta.RenameTemplate = cfg.RenameTemplate
+	saveDir, meta := fs.applyRule(rule, cfg.SaveDir, meta)
+	fileName, _ := previewRename(meta.RenameTemplate, meta.Name)
+	match := RuleMatch{
+		SaveDir:  saveDir,
+		FileName: fileName,
+		Compress: fs.shouldCompress(meta),
+		MIMEType: f.mimeType,
+	}
+	if rule != nil {
+		match.RuleID = rule.ID
+		match.RuleName = rule.Name
+	}
+	return match
+}